@@ -0,0 +1,109 @@
+package diskie
+
+import (
+	"context"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Objects is the udisks object tree, as returned by
+// org.freedesktop.DBus.ObjectManager.GetManagedObjects:
+// object path -> interface -> property -> value.
+type Objects = map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+
+// Backend is what Conn uses to talk to udisks.
+// The default backend talks to udisksd on the system bus;
+// package diskietest has an in-memory one.
+type Backend interface {
+	// ManagedObjects returns the udisks object tree.
+	// The caller may modify the returned maps.
+	ManagedObjects(ctx context.Context) (Objects, error)
+
+	// Call calls a udisks method on the object at objectPath,
+	// and stores the values it returns in ret.
+	// Failures of the method itself are returned as dbus.Error.
+	Call(ctx context.Context, objectPath dbus.ObjectPath, method string, args []any, ret ...any) error
+
+	// Subscribe sends the InterfacesAdded and InterfacesRemoved signals
+	// of the udisks object manager, and the PropertiesChanged signals
+	// of the udisks objects on signals,
+	// until the returned function is called.
+	Subscribe(signals chan<- *dbus.Signal) (unsubscribe func(), err error)
+}
+
+// NewConn creates a Conn that uses the given backend.
+func NewConn(backend Backend) *Conn {
+	return &Conn{
+		backend: backend,
+	}
+}
+
+type busBackend struct {
+	conn *dbus.Conn
+}
+
+func (b *busBackend) ManagedObjects(ctx context.Context) (Objects, error) {
+	obj := b.conn.Object(
+		"org.freedesktop.UDisks2",
+		"/org/freedesktop/UDisks2",
+	)
+
+	var objects Objects
+
+	err := obj.CallWithContext(ctx, "org.freedesktop.DBus.ObjectManager.GetManagedObjects", 0).Store(&objects)
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (b *busBackend) Call(ctx context.Context, objectPath dbus.ObjectPath, method string, args []any, ret ...any) error {
+	obj := b.conn.Object("org.freedesktop.UDisks2", objectPath)
+
+	call := obj.CallWithContext(ctx, method, 0, args...)
+	if call.Err != nil || len(ret) == 0 {
+		return call.Err
+	}
+
+	return call.Store(ret...)
+}
+
+func (b *busBackend) Subscribe(signals chan<- *dbus.Signal) (func(), error) {
+	// only udisksd may announce device changes,
+	// not any other client of the system bus
+	matches := [][]dbus.MatchOption{
+		{
+			dbus.WithMatchSender("org.freedesktop.UDisks2"),
+			dbus.WithMatchObjectPath("/org/freedesktop/UDisks2"),
+			dbus.WithMatchInterface("org.freedesktop.DBus.ObjectManager"),
+		},
+		{
+			dbus.WithMatchSender("org.freedesktop.UDisks2"),
+			dbus.WithMatchPathNamespace("/org/freedesktop/UDisks2"),
+			dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+			dbus.WithMatchMember("PropertiesChanged"),
+		},
+	}
+
+	for i, match := range matches {
+		err := b.conn.AddMatchSignal(match...)
+		if err != nil {
+			for _, match := range matches[:i] {
+				b.conn.RemoveMatchSignal(match...)
+			}
+			return nil, err
+		}
+	}
+
+	b.conn.Signal(signals)
+
+	unsubscribe := func() {
+		b.conn.RemoveSignal(signals)
+		for _, match := range matches {
+			b.conn.RemoveMatchSignal(match...)
+		}
+	}
+
+	return unsubscribe, nil
+}
@@ -0,0 +1,180 @@
+package diskie_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie"
+	"github.com/koonix/diskie/diskietest"
+)
+
+// loopObjects returns an object tree with a partitioned drive
+// and the given number of loop devices, like a machine with many snaps.
+func loopObjects(loops int) diskie.Objects {
+	objects := diskie.Objects{
+		"/org/freedesktop/UDisks2/Manager": {
+			"org.freedesktop.UDisks2.Manager": {
+				"Version": dbus.MakeVariant("2.10.1"),
+			},
+		},
+		"/org/freedesktop/UDisks2/drives/Samsung_SSD": {
+			"org.freedesktop.UDisks2.Drive": {
+				"Vendor":  dbus.MakeVariant(""),
+				"Model":   dbus.MakeVariant("Samsung SSD 980 1TB"),
+				"Id":      dbus.MakeVariant("Samsung-SSD-980-1TB-S64ANJ0R"),
+				"SortKey": dbus.MakeVariant("00coldplug/00fixed/nvme0n1"),
+			},
+		},
+		"/org/freedesktop/UDisks2/block_devices/nvme0n1": {
+			"org.freedesktop.UDisks2.Block": block("/dev/nvme0n1", "/org/freedesktop/UDisks2/drives/Samsung_SSD", "", ""),
+			"org.freedesktop.UDisks2.PartitionTable": {
+				"Type": dbus.MakeVariant("gpt"),
+				"Partitions": dbus.MakeVariant([]dbus.ObjectPath{
+					"/org/freedesktop/UDisks2/block_devices/nvme0n1p1",
+				}),
+			},
+		},
+		"/org/freedesktop/UDisks2/block_devices/nvme0n1p1": {
+			"org.freedesktop.UDisks2.Block": block("/dev/nvme0n1p1", "/org/freedesktop/UDisks2/drives/Samsung_SSD", "filesystem", "ext4"),
+			"org.freedesktop.UDisks2.Partition": {
+				"Number": dbus.MakeVariant(uint32(1)),
+				"Table":  dbus.MakeVariant(dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/nvme0n1")),
+			},
+			"org.freedesktop.UDisks2.Filesystem": {
+				"MountPoints": dbus.MakeVariant([][]byte{append([]byte("/"), 0)}),
+				"Size":        dbus.MakeVariant(uint64(1 << 40)),
+			},
+		},
+	}
+
+	for i := range loops {
+		p := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/UDisks2/block_devices/loop%d", i))
+		objects[p] = map[string]map[string]dbus.Variant{
+			"org.freedesktop.UDisks2.Block": block(fmt.Sprintf("/dev/loop%d", i), "/", "filesystem", "squashfs"),
+			"org.freedesktop.UDisks2.Loop": {
+				"BackingFile": dbus.MakeVariant(append([]byte(fmt.Sprintf("/var/lib/snapd/snaps/core_%d.snap", i)), 0)),
+				"Autoclear":   dbus.MakeVariant(false),
+				"SetupByUID":  dbus.MakeVariant(uint32(0)),
+			},
+			"org.freedesktop.UDisks2.Filesystem": {
+				"MountPoints": dbus.MakeVariant([][]byte{append([]byte(fmt.Sprintf("/snap/core/%d", i)), 0)}),
+				"Size":        dbus.MakeVariant(uint64(0)),
+			},
+		}
+	}
+
+	return objects
+}
+
+func block(device string, drive dbus.ObjectPath, usage string, fsType string) map[string]dbus.Variant {
+	return map[string]dbus.Variant{
+		"Device":              dbus.MakeVariant(append([]byte(device), 0)),
+		"PreferredDevice":     dbus.MakeVariant(append([]byte(device), 0)),
+		"Symlinks":            dbus.MakeVariant([][]byte{}),
+		"Size":                dbus.MakeVariant(uint64(1 << 30)),
+		"Drive":               dbus.MakeVariant(drive),
+		"CryptoBackingDevice": dbus.MakeVariant(dbus.ObjectPath("/")),
+		"IdUsage":             dbus.MakeVariant(usage),
+		"IdType":              dbus.MakeVariant(fsType),
+		"IdLabel":             dbus.MakeVariant(""),
+		"IdUUID":              dbus.MakeVariant(""),
+		"HintSystem":          dbus.MakeVariant(true),
+		"HintIgnore":          dbus.MakeVariant(false),
+		"HintAuto":            dbus.MakeVariant(false),
+	}
+}
+
+// perObjectBlockDevices fetches the block devices the way BlockDevices did
+// before it used GetManagedObjects: GetBlockDevices, then for every device
+// GetAll on Block, Get on Block.Drive, GetAll on the Drive,
+// and GetAll on Partition, Filesystem and Encrypted.
+func perObjectBlockDevices(conn *dbus.Conn) (int, error) {
+	var paths []dbus.ObjectPath
+
+	manager := conn.Object("org.freedesktop.UDisks2", "/org/freedesktop/UDisks2/Manager")
+	err := manager.Call("org.freedesktop.UDisks2.Manager.GetBlockDevices", 0, map[string]dbus.Variant{}).Store(&paths)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range paths {
+		obj := conn.Object("org.freedesktop.UDisks2", p)
+
+		var props map[string]dbus.Variant
+		err := obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, "org.freedesktop.UDisks2.Block").Store(&props)
+		if err != nil {
+			return 0, err
+		}
+
+		var drive dbus.Variant
+		err = obj.Call("org.freedesktop.DBus.Properties.Get", 0, "org.freedesktop.UDisks2.Block", "Drive").Store(&drive)
+		if err != nil {
+			return 0, err
+		}
+		if drivePath, _ := drive.Value().(dbus.ObjectPath); drivePath != "/" {
+			err = conn.Object("org.freedesktop.UDisks2", drivePath).Call("org.freedesktop.DBus.Properties.GetAll", 0, "org.freedesktop.UDisks2.Drive").Store(&props)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		// the interfaces that the device doesn't have fail with UnknownInterface
+		for _, iface := range []string{"Partition", "Filesystem", "Encrypted"} {
+			obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, "org.freedesktop.UDisks2."+iface).Store(&props)
+		}
+	}
+
+	return len(paths), nil
+}
+
+func BenchmarkBlockDevices(b *testing.B) {
+	needDBusDaemon(b)
+
+	for _, loops := range []int{8, 64} {
+		backend := diskietest.New(loopObjects(loops), nil)
+
+		service, err := diskietest.StartService(backend)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { service.Close() })
+
+		b.Run(fmt.Sprintf("GetManagedObjects/%d-loops", loops), func(b *testing.B) {
+			b.Setenv("DBUS_SYSTEM_BUS_ADDRESS", service.Address)
+
+			dsk, err := diskie.Connect()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+
+			for range b.N {
+				blockmap, err := dsk.BlockDevices()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(blockmap.BlockMap) != loops+2 {
+					b.Fatalf("got %d block devices, want %d", len(blockmap.BlockMap), loops+2)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("PerObjectGetAll/%d-loops", loops), func(b *testing.B) {
+			conn := connect(b, service.Address)
+
+			b.ResetTimer()
+
+			for range b.N {
+				n, err := perObjectBlockDevices(conn)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if n != loops+2 {
+					b.Fatalf("got %d block devices, want %d", n, loops+2)
+				}
+			}
+		})
+	}
+}
@@ -8,6 +8,11 @@ import (
 
 type BlockMap struct {
 	BlockMap map[string]*BlockDevice
+
+	// problems that were worked around while building the BlockMap,
+	// such as properties of unexpected types (*DecodeError)
+	// or links to devices that don't exist (*UnresolvedLinkError).
+	Warnings []error `json:"-"`
 }
 
 func (bm *BlockMap) Filter(blocks []*BlockDevice, minImportance uint) ([]*BlockDevice, error) {
@@ -17,30 +22,8 @@ func (bm *BlockMap) Filter(blocks []*BlockDevice, minImportance uint) ([]*BlockD
 
 	filtered := make([]*BlockDevice, 0, len(blocks))
 
-	importance := func(b *BlockDevice) uint {
-		if b.IdUsage != nil && *b.IdUsage != "filesystem" && *b.IdUsage != "crypto" {
-			return 0
-		}
-		if b.HintAuto != nil && *b.HintAuto {
-			return 3
-		}
-		if b.HintIgnore != nil && *b.HintIgnore {
-			return 1
-		}
-		if b.HintSystem != nil && *b.HintSystem {
-			return 2
-		}
-		d := b.CryptoRootDrive
-		if d != nil && d.MediaAvailable != nil {
-			if !*d.MediaAvailable {
-				return 2
-			}
-		}
-		return 1
-	}
-
 	for _, b := range blocks {
-		if importance(b) >= minImportance {
+		if b.Importance() >= minImportance {
 			filtered = append(filtered, b)
 		}
 	}
@@ -48,6 +31,30 @@ func (bm *BlockMap) Filter(blocks []*BlockDevice, minImportance uint) ([]*BlockD
 	return filtered, nil
 }
 
+// Importance returns the importance level of the device, from 0 through 3.
+// See the LIMIT section of the man page for the meaning of each level.
+func (b *BlockDevice) Importance() uint {
+	if b.IdUsage != nil && *b.IdUsage != "filesystem" && *b.IdUsage != "crypto" {
+		return 0
+	}
+	if b.HintAuto != nil && *b.HintAuto {
+		return 3
+	}
+	if b.HintIgnore != nil && *b.HintIgnore {
+		return 1
+	}
+	if b.HintSystem != nil && *b.HintSystem {
+		return 2
+	}
+	d := b.CryptoRootDrive
+	if d != nil && d.MediaAvailable != nil {
+		if !*d.MediaAvailable {
+			return 2
+		}
+	}
+	return 1
+}
+
 func (bm *BlockMap) Sort() []*BlockDevice {
 
 	blocks := make([]*BlockDevice, 0, len(bm.BlockMap))
@@ -64,9 +71,9 @@ func (bm *BlockMap) Sort() []*BlockDevice {
 			}
 
 			rootSize := uint64(0)
-			s := bm.BlockMap[b.CryptoRootDevice].PreferredSize
-			if s != nil {
-				rootSize = *s
+			root, has := bm.BlockMap[b.CryptoRootDevice]
+			if has && root.PreferredSize != nil {
+				rootSize = *root.PreferredSize
 			}
 
 			usage := "00other"
@@ -91,3 +98,62 @@ func (bm *BlockMap) Sort() []*BlockDevice {
 
 	return blocks
 }
+
+// Parent returns the device that b sits on:
+// the device with the partition table for partitions,
+// and the encrypted device for cleartext devices.
+// It returns nil for devices that don't sit on another device,
+// or whose parent isn't in the BlockMap.
+func (bm *BlockMap) Parent(b *BlockDevice) *BlockDevice {
+	if b.Partition != nil && b.Partition.Table != nil {
+		return bm.BlockMap[*b.Partition.Table]
+	}
+	if b.CryptoBackingDevice != nil && *b.CryptoBackingDevice != "/" {
+		return bm.BlockMap[*b.CryptoBackingDevice]
+	}
+	return nil
+}
+
+// Children returns the devices whose parent is b (see Parent):
+// its partitions, ordered by their number,
+// and then its cleartext device if it's unlocked.
+func (bm *BlockMap) Children(b *BlockDevice) []*BlockDevice {
+	children := bm.PartitionsOf(b)
+	c := bm.CleartextOf(b)
+	if c != nil {
+		children = append(children, c)
+	}
+	return children
+}
+
+// PartitionsOf returns the partitions of the partition table on b,
+// ordered by their number.
+func (bm *BlockMap) PartitionsOf(b *BlockDevice) []*BlockDevice {
+	var partitions []*BlockDevice
+
+	for _, p := range bm.BlockMap {
+		if p.Partition != nil && p.Partition.Table != nil && *p.Partition.Table == b.ObjectPath {
+			partitions = append(partitions, p)
+		}
+	}
+
+	slices.SortFunc(partitions, func(x, y *BlockDevice) int {
+		return cmp.Or(
+			cmp.Compare(deref(x.Partition.Number), deref(y.Partition.Number)),
+			cmp.Compare(deref(x.Partition.Offset), deref(y.Partition.Offset)),
+			cmp.Compare(x.ObjectPath, y.ObjectPath),
+		)
+	})
+
+	return partitions
+}
+
+// CleartextOf returns the cleartext device of b,
+// or nil if b isn't an unlocked encrypted device.
+func (bm *BlockMap) CleartextOf(b *BlockDevice) *BlockDevice {
+	e := b.Encrypted
+	if e == nil || e.CleartextDevice == nil || *e.CleartextDevice == "/" {
+		return nil
+	}
+	return bm.BlockMap[*e.CleartextDevice]
+}
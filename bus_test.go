@@ -0,0 +1,71 @@
+package diskie_test
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie/diskietest"
+)
+
+// needDBusDaemon skips the test if dbus-daemon is not installed.
+func needDBusDaemon(t testing.TB) {
+	t.Helper()
+
+	_, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not in PATH")
+	}
+}
+
+// startBus starts a private dbus-daemon for the test,
+// or skips the test if dbus-daemon is not installed.
+func startBus(t testing.TB) *diskietest.Bus {
+	t.Helper()
+
+	needDBusDaemon(t)
+
+	bus, err := diskietest.StartBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bus.Close() })
+
+	return bus
+}
+
+// connect connects to the bus and closes the connection when the test is done.
+func connect(t testing.TB, address string) *dbus.Conn {
+	t.Helper()
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// serve exports obj on its own connection to the bus under the given name,
+// and returns the connection.
+func serve(t testing.TB, address string, name string, path dbus.ObjectPath, iface string, obj any) *dbus.Conn {
+	t.Helper()
+
+	conn := connect(t, address)
+
+	err := conn.Export(obj, path, iface)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("could not own %s", name)
+	}
+
+	return conn
+}
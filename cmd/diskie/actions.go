@@ -0,0 +1,339 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/koonix/diskie"
+)
+
+func cmdAttach(device string, passwordFile string, askpass []string, attempts uint, unlock bool, open bool, opener []string) error {
+	dsk, err := connect()
+	if err != nil {
+		return fmt.Errorf("could not create diskie client: %w", err)
+	}
+
+	blockmap, err := blockDevices(dsk)
+	if err != nil {
+		return fmt.Errorf("could not get block devices: %w", err)
+	}
+
+	b, err := blockmap.Resolve(device)
+	if err != nil {
+		return err
+	}
+
+	source := newPasswordSource(passwordFile, askpass)
+
+	mounted, mountpoint, err := attach(dsk, blockmap, b, source, attempts, unlock, diskie.MountOptions{})
+	if err != nil {
+		notify("Could not mount "+deviceName(b), b, err.Error())
+		return err
+	}
+
+	fmt.Println(mountpoint)
+
+	notify("Mounted "+deviceName(b), mounted, mountpoint)
+
+	if open {
+		err := diskie.OpenFolder(mountpoint, opener)
+		if err != nil {
+			return fmt.Errorf("could not open the mountpoint: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// attach mounts the filesystem of the device, and returns it and its mountpoint.
+// if unlock is true, the encryption layers on top of the filesystem
+// are unlocked first using the given password source.
+func attach(
+	dsk *diskie.Conn, blockmap *diskie.BlockMap, b *diskie.BlockDevice,
+	source passwordSource, attempts uint, unlock bool, opts diskie.MountOptions) (
+	*diskie.BlockDevice, string, error) {
+
+	name := deviceName(b)
+
+	// walk down the encryption layers until we reach the filesystem
+	for unlock && b.Encrypted != nil {
+		c := b.Encrypted.CleartextDevice
+		if c != nil && *c != "/" {
+			cleartext, has := blockmap.BlockMap[*c]
+			if !has {
+				return nil, "", fmt.Errorf("CleartextDevice not found in the list of devices: %s", *c)
+			}
+			b = cleartext
+			continue
+		}
+
+		if source == nil {
+			return nil, "", fmt.Errorf("device %s is encrypted and no password source is configured", name)
+		}
+
+		var err error
+		b, err = unlockWithRetry(dsk, b, source, attempts)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not unlock %s: %w", name, err)
+		}
+	}
+
+	if b.Filesystem == nil {
+		if b.Encrypted != nil {
+			return nil, "", fmt.Errorf("device %s is encrypted and must be unlocked first", name)
+		}
+		return nil, "", fmt.Errorf("device %s does not contain a filesystem", name)
+	}
+
+	mp := b.Filesystem.MountPoints
+	if mp != nil && len(*mp) > 0 {
+		return b, (*mp)[0], nil
+	}
+
+	ctx, cancel := callContext()
+	defer cancel()
+
+	mountpoint, err := dsk.MountContext(ctx, b.ObjectPath, opts)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not mount %s: %w", name, err)
+	}
+
+	return b, mountpoint, nil
+}
+
+func cmdDetach(device string, lock bool, kill bool) error {
+	dsk, err := connect()
+	if err != nil {
+		return fmt.Errorf("could not create diskie client: %w", err)
+	}
+
+	blockmap, err := blockDevices(dsk)
+	if err != nil {
+		return fmt.Errorf("could not get block devices: %w", err)
+	}
+
+	b, err := blockmap.Resolve(device)
+	if err != nil {
+		return err
+	}
+
+	err = detach(dsk, blockmap, b, lock)
+	if err != nil && kill && offerKill(err) {
+		// the failed unmount left the devices as they were
+		err = detach(dsk, blockmap, b, lock)
+	}
+	if err != nil && lock {
+		notify("Could not detach "+deviceName(b), b, err.Error())
+		return err
+	} else if err != nil {
+		notify("Could not unmount "+deviceName(b), b, err.Error())
+		return err
+	}
+
+	if lock {
+		notify("Detached "+deviceName(b), b, "")
+	} else {
+		notify("Unmounted "+deviceName(b), b, "")
+	}
+
+	return nil
+}
+
+// detach unmounts the filesystem on top of the device.
+// if lock is true, the encryption layers under the filesystem are locked afterwards.
+func detach(dsk *diskie.Conn, blockmap *diskie.BlockMap, b *diskie.BlockDevice, lock bool) error {
+	name := deviceName(b)
+
+	closing, has := blockmap.BlockMap[b.CryptoClosingDevice]
+	if !has {
+		return fmt.Errorf("CryptoClosingDevice not found in the list of devices: %s", b.CryptoClosingDevice)
+	}
+
+	done := false
+
+	fs := closing.Filesystem
+	if fs != nil && fs.MountPoints != nil && len(*fs.MountPoints) > 0 {
+		ctx, cancel := callContext()
+		defer cancel()
+
+		err := dsk.UnmountContext(ctx, closing.ObjectPath, diskie.UnmountOptions{})
+		if err != nil {
+			return fmt.Errorf("could not unmount %s: %w", name, err)
+		}
+		done = true
+	}
+
+	// walk back up the encryption layers, locking each one
+	for c := closing; lock && c.CryptoBackingDevice != nil && *c.CryptoBackingDevice != "/"; {
+		backing, has := blockmap.BlockMap[*c.CryptoBackingDevice]
+		if !has {
+			return fmt.Errorf("CryptoBackingDevice not found in the list of devices: %s", *c.CryptoBackingDevice)
+		}
+		ctx, cancel := callContext()
+		defer cancel()
+
+		err := dsk.LockContext(ctx, backing.ObjectPath)
+		if err != nil {
+			return fmt.Errorf("could not lock %s: %w", backing.ObjectPath, err)
+		}
+		done = true
+		c = backing
+	}
+
+	if !done && lock {
+		return fmt.Errorf("device %s is neither mounted nor unlocked", name)
+	} else if !done {
+		return fmt.Errorf("device %s is %w", name, diskie.ErrNotMounted)
+	}
+
+	return nil
+}
+
+func cmdRemove(device string, kill bool) error {
+	dsk, err := connect()
+	if err != nil {
+		return fmt.Errorf("could not create diskie client: %w", err)
+	}
+
+	blockmap, err := blockDevices(dsk)
+	if err != nil {
+		return fmt.Errorf("could not get block devices: %w", err)
+	}
+
+	b, err := blockmap.Resolve(device)
+	if err != nil {
+		return err
+	}
+
+	drive := b.CryptoRootDrive
+	if drive == nil {
+		return fmt.Errorf("device %s does not belong to a drive", deviceName(b))
+	}
+
+	err = remove(dsk, blockmap, drive)
+	if err != nil && kill && offerKill(err) {
+		blockmap, err = blockDevices(dsk)
+		if err != nil {
+			return fmt.Errorf("could not get block devices: %w", err)
+		}
+		err = remove(dsk, blockmap, drive)
+	}
+	if err != nil {
+		notify("Could not remove "+driveName(drive), b, err.Error())
+		return err
+	}
+
+	notify("Removed "+driveName(drive), b, "It's now safe to unplug the drive.")
+
+	return nil
+}
+
+// remove unmounts the filesystems and locks the encrypted devices of the drive,
+// then powers it off or ejects it.
+// the error tells which step failed.
+func remove(dsk *diskie.Conn, blockmap *diskie.BlockMap, drive *diskie.Drive) error {
+	name := driveName(drive)
+
+	powerOff := drive.CanPowerOff != nil && *drive.CanPowerOff
+	eject := drive.Ejectable != nil && *drive.Ejectable
+
+	// don't unmount anything if the drive can't be removed anyway
+	if !powerOff && !eject {
+		return fmt.Errorf("could not remove %s: it can neither be powered off nor ejected", name)
+	}
+
+	var blocks []*diskie.BlockDevice
+	for _, b := range blockmap.BlockMap {
+		d := b.CryptoRootDrive
+		if d != nil && d.ObjectPath == drive.ObjectPath {
+			blocks = append(blocks, b)
+		}
+	}
+
+	// handle the devices that sit on other devices first
+	depth := func(b *diskie.BlockDevice) int {
+		d := 0
+		for p := blockmap.Parent(b); p != nil && d < len(blockmap.BlockMap); p = blockmap.Parent(p) {
+			d++
+		}
+		return d
+	}
+	slices.SortFunc(blocks, func(x, y *diskie.BlockDevice) int {
+		return cmp.Or(
+			cmp.Compare(depth(y), depth(x)),
+			cmp.Compare(x.ObjectPath, y.ObjectPath),
+		)
+	})
+
+	for _, b := range blocks {
+		fs := b.Filesystem
+		if fs == nil || fs.MountPoints == nil || len(*fs.MountPoints) == 0 {
+			continue
+		}
+		ctx, cancel := callContext()
+		defer cancel()
+
+		err := dsk.UnmountContext(ctx, b.ObjectPath, diskie.UnmountOptions{})
+		if err != nil {
+			return fmt.Errorf("could not remove %s: could not unmount %s: %w", name, deviceName(b), err)
+		}
+	}
+
+	for _, b := range blocks {
+		e := b.Encrypted
+		if e == nil || e.CleartextDevice == nil || *e.CleartextDevice == "/" {
+			continue
+		}
+		ctx, cancel := callContext()
+		defer cancel()
+
+		err := dsk.LockContext(ctx, b.ObjectPath)
+		if err != nil {
+			return fmt.Errorf("could not remove %s: could not lock %s: %w", name, deviceName(b), err)
+		}
+	}
+
+	ctx, cancel := callContext()
+	defer cancel()
+
+	if powerOff {
+		err := dsk.PowerOffContext(ctx, drive.ObjectPath)
+		if err != nil {
+			return fmt.Errorf("could not remove %s: could not power it off: %w", name, err)
+		}
+	} else {
+		err := dsk.EjectContext(ctx, drive.ObjectPath)
+		if err != nil {
+			return fmt.Errorf("could not remove %s: could not eject it: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// driveName returns a name for the drive that's suitable for messages.
+func driveName(d *diskie.Drive) string {
+	var parts []string
+	for _, s := range []*string{d.Vendor, d.Model} {
+		if s != nil && *s != "" {
+			parts = append(parts, *s)
+		}
+	}
+	if len(parts) > 0 {
+		return strings.Join(parts, " ")
+	}
+	if d.Id != nil && *d.Id != "" {
+		return *d.Id
+	}
+	return d.ObjectPath
+}
+
+// deviceName returns a name for the device that's suitable for messages.
+func deviceName(b *diskie.BlockDevice) string {
+	if b.PreferredDevice != nil && *b.PreferredDevice != "" {
+		return *b.PreferredDevice
+	}
+	return b.ObjectPath
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie"
+	"github.com/koonix/diskie/diskietest"
+)
+
+// call is a udisks method call made through recordingBackend.
+type call struct {
+	objectPath dbus.ObjectPath
+	method     string
+	args       []any
+}
+
+// recordingBackend records the calls made through it.
+// the byte slices in options are copied,
+// since passwords are zeroed once the call returns.
+type recordingBackend struct {
+	*diskietest.Backend
+	mu    sync.Mutex
+	calls []call
+}
+
+func (r *recordingBackend) Call(ctx context.Context, objectPath dbus.ObjectPath, method string, args []any, ret ...any) error {
+	recorded := slices.Clone(args)
+	for i, arg := range recorded {
+		options, ok := arg.(map[string]dbus.Variant)
+		if !ok {
+			continue
+		}
+		copied := make(map[string]dbus.Variant, len(options))
+		for k, v := range options {
+			if b, ok := v.Value().([]byte); ok {
+				v = dbus.MakeVariant(slices.Clone(b))
+			}
+			copied[k] = v
+		}
+		recorded[i] = copied
+	}
+
+	r.mu.Lock()
+	r.calls = append(r.calls, call{objectPath, method, recorded})
+	r.mu.Unlock()
+
+	return r.Backend.Call(ctx, objectPath, method, args, ret...)
+}
+
+// find returns the arguments of the last call of the method.
+func (r *recordingBackend) find(method string) ([]any, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.calls) - 1; i >= 0; i-- {
+		if r.calls[i].method == method {
+			return r.calls[i].args, true
+		}
+	}
+	return nil, false
+}
+
+// actions returns the calls other than property reads,
+// as the method name followed by the base name of the object path.
+func (r *recordingBackend) actions() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var actions []string
+	for _, c := range r.calls {
+		if strings.HasPrefix(c.method, "org.freedesktop.DBus.") {
+			continue
+		}
+		method := c.method[strings.LastIndexByte(c.method, '.')+1:]
+		actions = append(actions, method+" "+path.Base(string(c.objectPath)))
+	}
+	return actions
+}
+
+func TestRemove(t *testing.T) {
+	const blocks = "/org/freedesktop/UDisks2/block_devices/"
+
+	tests := []struct {
+		name    string
+		fixture string
+
+		// devices to unlock with the passphrase "hunter2", and then to mount
+		unlock []string
+		mount  []string
+
+		// device whose filesystem is busy
+		busy string
+
+		device  string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "LUKS in partition",
+			fixture: "luks-in-partition",
+			unlock:  []string{"sdb1"},
+			mount:   []string{"sdb2", "dm_2d0"},
+			device:  "/dev/sdb2",
+			// the cleartext device sits deepest, so it's unmounted first
+			want: []string{"Unmount dm_2d0", "Unmount sdb2", "Lock sdb1", "PowerOff SanDisk_Ultra_4C530001230621116393"},
+		},
+		{
+			name:    "LUKS in partition, locked",
+			fixture: "luks-in-partition",
+			device:  "/dev/sdb",
+			want:    []string{"PowerOff SanDisk_Ultra_4C530001230621116393"},
+		},
+		{
+			name:    "LUKS in partition, busy",
+			fixture: "luks-in-partition",
+			unlock:  []string{"sdb1"},
+			mount:   []string{"sdb2", "dm_2d0"},
+			busy:    "sdb2",
+			device:  "/dev/sdb1",
+			want:    []string{"Unmount dm_2d0", "Unmount sdb2"},
+			wantErr: "could not unmount /dev/sdb2",
+		},
+		{
+			// the drive can't be powered off, so it's ejected
+			name:    "optical",
+			fixture: "optical",
+			mount:   []string{"sr0"},
+			device:  "/dev/sr0",
+			want:    []string{"Unmount sr0", "Eject HL_DT_ST_DVDRAM_GH24NSD1_KZ4H9LB1234"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, err := diskietest.Load("../../diskietest/fixtures/" + tt.fixture + ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := &recordingBackend{Backend: backend}
+			dsk := diskie.NewConn(rec)
+
+			for _, name := range tt.unlock {
+				_, err := dsk.Unlock(blocks+name, []byte("hunter2"), diskie.UnlockOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, name := range tt.mount {
+				_, err := dsk.Mount(blocks+name, diskie.MountOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.busy != "" {
+				backend.SetBusy(blocks+tt.busy, true)
+			}
+
+			blockmap, err := dsk.BlockDevices()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := blockmap.Resolve(tt.device)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec.calls = nil
+
+			err = remove(dsk, blockmap, b.CryptoRootDrive)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want one that says %q", err, tt.wantErr)
+				}
+				if !errors.Is(err, diskie.ErrDeviceBusy) {
+					t.Errorf("the error %v doesn't wrap ErrDeviceBusy", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := rec.actions(); !slices.Equal(got, tt.want) {
+				t.Errorf("got calls %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
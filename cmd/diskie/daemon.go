@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/koonix/diskie"
+)
+
+// rule decides what the daemon does with a device.
+// empty fields match any device, and string fields are glob patterns.
+type rule struct {
+	IdUUID        string
+	IdLabel       string
+	IdType        string
+	DriveSerial   string
+	ConnectionBus string
+	MinImportance uint
+
+	// "mount", "ignore" or "ask"
+	Action       string
+	FSType       string
+	MountOptions []string
+}
+
+type daemon struct {
+	dsk      *diskie.Conn
+	rules    []rule
+	source   passwordSource
+	attempts uint
+	askCmd   []string
+
+	// guards handled and busy
+	mu sync.Mutex
+
+	// filesystems mounted by the daemon.
+	// they're not mounted again until they're removed,
+	// so that unmounting them manually sticks.
+	handled map[string]bool
+
+	// devices that are being handled.
+	// each device is handled in its own goroutine,
+	// so that waiting on the user to answer or enter a password
+	// doesn't hold up the other devices and the events.
+	busy map[string]bool
+
+	// only one question is asked at a time
+	askMu sync.Mutex
+}
+
+func cmdDaemon(rulesFile string, passwordFile string, askpass []string, attempts uint, askCmd []string) error {
+	rules, err := readRules(rulesFile)
+	if err != nil {
+		return err
+	}
+
+	dsk, err := connect()
+	if err != nil {
+		return fmt.Errorf("could not create diskie client: %w", err)
+	}
+
+	d := &daemon{
+		dsk:      dsk,
+		rules:    rules,
+		attempts: attempts,
+		askCmd:   askCmd,
+		handled:  make(map[string]bool),
+		busy:     make(map[string]bool),
+	}
+
+	// unlike the other commands,
+	// the daemon doesn't fall back to asking on the terminal
+	if passwordFile != "" || len(askpass) > 0 {
+		d.source = newPasswordSource(passwordFile, askpass)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return d.run(ctx)
+}
+
+// run handles the devices that are present and the devices that are added,
+// until ctx is done.
+func (d *daemon) run(ctx context.Context) error {
+	events, err := d.dsk.Watch(ctx)
+	if err != nil {
+		return fmt.Errorf("could not watch block devices: %w", err)
+	}
+
+	// handle the devices that are already present
+	blockmap, err := blockDevices(d.dsk)
+	if err != nil {
+		return fmt.Errorf("could not get block devices: %w", err)
+	}
+	for _, b := range blockmap.Sort() {
+		d.handle(blockmap, b)
+	}
+
+	for event := range events {
+		switch event.Type {
+		case diskie.DeviceAdded:
+			b := event.Device
+			d.mu.Lock()
+			handled := d.handled[b.ObjectPath]
+			d.mu.Unlock()
+			if !handled && b.Importance() > 0 {
+				notify("Device added: "+deviceName(b), b, b.DriveModel)
+			}
+			d.handle(event.BlockMap, b)
+		case diskie.MediaChanged:
+			d.mu.Lock()
+			delete(d.handled, event.Device.ObjectPath)
+			d.mu.Unlock()
+			d.handle(event.BlockMap, event.Device)
+		case diskie.DeviceRemoved:
+			d.mu.Lock()
+			delete(d.handled, event.Device.ObjectPath)
+			d.mu.Unlock()
+		}
+	}
+
+	return nil
+}
+
+// handle mounts the device in the background if the rules say so.
+func (d *daemon) handle(blockmap *diskie.BlockMap, b *diskie.BlockDevice) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.handled[b.ObjectPath] || d.busy[b.ObjectPath] {
+		return
+	}
+
+	// the cleartext device of an encrypted device that is being unlocked
+	// is mounted by the goroutine that unlocks it
+	c := b.CryptoBackingDevice
+	if c != nil && d.busy[*c] {
+		return
+	}
+
+	d.busy[b.ObjectPath] = true
+
+	go func() {
+		d.mount(blockmap, b)
+		d.mu.Lock()
+		delete(d.busy, b.ObjectPath)
+		d.mu.Unlock()
+	}()
+}
+
+// mount mounts the device if the rules say so.
+func (d *daemon) mount(blockmap *diskie.BlockMap, b *diskie.BlockDevice) {
+	if b.Filesystem == nil && b.Encrypted == nil {
+		return
+	}
+	if b.Filesystem != nil && b.Filesystem.MountPoints != nil && len(*b.Filesystem.MountPoints) > 0 {
+		return
+	}
+	if b.Encrypted != nil && (d.source == nil || b.CryptoClosingDevice != b.ObjectPath) {
+		return
+	}
+
+	r := d.match(b)
+
+	switch r.Action {
+	case "ignore":
+		return
+	case "ask":
+		ok, err := d.ask(b)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		if !ok {
+			return
+		}
+	}
+
+	opts := diskie.MountOptions{
+		FSType:  r.FSType,
+		Options: r.MountOptions,
+	}
+
+	mounted, mountpoint, err := attach(d.dsk, blockmap, b, d.source, d.attempts, true, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		notify("Could not mount "+deviceName(b), b, err.Error())
+		return
+	}
+
+	d.mu.Lock()
+	d.handled[mounted.ObjectPath] = true
+	d.mu.Unlock()
+
+	fmt.Printf("mounted %s at %s\n", deviceName(b), mountpoint)
+
+	notify("Mounted "+deviceName(b), mounted, mountpoint,
+		diskie.NotificationAction{
+			Key:   "open",
+			Label: "Open",
+			Callback: func() {
+				err := diskie.OpenFolder(mountpoint, nil)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+			},
+		},
+		diskie.NotificationAction{
+			Key:   "unmount",
+			Label: "Unmount",
+			Callback: func() {
+				d.unmount(mounted.ObjectPath)
+			},
+		},
+	)
+}
+
+// unmount is run when the "Unmount" action of a notification is invoked.
+func (d *daemon) unmount(objectPath string) {
+	blockmap, err := blockDevices(d.dsk)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "could not get block devices:", err)
+		return
+	}
+
+	b, has := blockmap.BlockMap[objectPath]
+	if !has {
+		return
+	}
+
+	err = detach(d.dsk, blockmap, b, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		notify("Could not unmount "+deviceName(b), b, err.Error())
+		return
+	}
+
+	notify("Unmounted "+deviceName(b), b, "")
+}
+
+// match returns the first rule that matches the device.
+// if no rule matches, the udisks hints decide whether to mount the device.
+func (d *daemon) match(b *diskie.BlockDevice) rule {
+	connectionBus := ""
+	if b.CryptoRootDrive != nil && b.CryptoRootDrive.ConnectionBus != nil {
+		connectionBus = *b.CryptoRootDrive.ConnectionBus
+	}
+
+	for _, r := range d.rules {
+		if globMatch(r.IdUUID, b.IdUUID) &&
+			globMatch(r.IdLabel, b.IdLabel) &&
+			globMatch(r.IdType, b.IdType) &&
+			globMatch(r.DriveSerial, &b.DriveSerial) &&
+			globMatch(r.ConnectionBus, &connectionBus) &&
+			b.Importance() >= r.MinImportance {
+			return r
+		}
+	}
+
+	if b.HintIgnore != nil && *b.HintIgnore {
+		return rule{Action: "ignore"}
+	}
+	if b.HintAuto != nil && *b.HintAuto {
+		return rule{Action: "mount"}
+	}
+	return rule{Action: "ignore"}
+}
+
+// ask asks the user whether to mount the device,
+// either using the ask command or on the controlling terminal.
+func (d *daemon) ask(b *diskie.BlockDevice) (bool, error) {
+	d.askMu.Lock()
+	defer d.askMu.Unlock()
+
+	name := deviceName(b)
+	if b.IdLabel != nil && *b.IdLabel != "" {
+		name = fmt.Sprintf("%s (%s)", name, *b.IdLabel)
+	}
+
+	if len(d.askCmd) > 0 {
+		args := make([]string, 0, len(d.askCmd)-1)
+		for _, arg := range d.askCmd[1:] {
+			args = append(args, strings.ReplaceAll(arg, "%d", name))
+		}
+
+		cmd := exec.Command(d.askCmd[0], args...)
+		cmd.Stdin = strings.NewReader("Mount\nIgnore")
+		cmd.Stderr = os.Stderr
+
+		output, err := cmd.Output()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("could not run the ask command: %w", err)
+		}
+
+		return strings.TrimSuffix(string(output), "\n") == "Mount", nil
+	}
+
+	ok, err := confirm(fmt.Sprintf("Mount %s?", name))
+	if err != nil {
+		return false, fmt.Errorf("could not ask whether to mount %s: %w", name, err)
+	}
+
+	return ok, nil
+}
+
+// readRules reads the rules from the given JSON file.
+// if file is empty, the rules are read from the default location if it exists.
+func readRules(file string) ([]rule, error) {
+	if file == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, nil
+		}
+		file = filepath.Join(dir, "diskie", "rules.json")
+		_, err = os.Stat(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+	}
+
+	file, err := expandTilde(file)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the rules file: %w", err)
+	}
+
+	var rules []rule
+
+	err = json.Unmarshal(f, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the rules file: %w", err)
+	}
+
+	for i, r := range rules {
+		switch r.Action {
+		case "mount", "ignore", "ask":
+		default:
+			return nil, fmt.Errorf("rule %d: unknown action: %q", i, r.Action)
+		}
+		if r.MinImportance > 3 {
+			return nil, fmt.Errorf("rule %d: MinImportance of %d is out of the possible range of 0 through 3", i, r.MinImportance)
+		}
+		for _, pattern := range []string{r.IdUUID, r.IdLabel, r.IdType, r.DriveSerial, r.ConnectionBus} {
+			_, err := path.Match(pattern, "")
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid pattern %q: %w", i, pattern, err)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+func globMatch(pattern string, v *string) bool {
+	if pattern == "" {
+		return true
+	}
+	s := ""
+	if v != nil {
+		s = *v
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie"
+	"github.com/koonix/diskie/diskietest"
+)
+
+// a device that waits for its password doesn't hold up the other devices.
+func TestDaemonHandlesDevicesConcurrently(t *testing.T) {
+	backend, err := diskietest.Load("../../diskietest/fixtures/luks-in-partition.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the askpass command doesn't answer until release exists
+	release := filepath.Join(t.TempDir(), "release")
+	askpass := []string{"sh", "-c", `while [ ! -e "$0" ]; do sleep 0.01; done; echo hunter2`, release}
+
+	d := &daemon{
+		dsk:      diskie.NewConn(backend),
+		source:   &cmdPasswordSource{cmd: askpass},
+		attempts: 1,
+		handled:  make(map[string]bool),
+		busy:     make(map[string]bool),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- d.run(ctx)
+	}()
+	defer func() {
+		cancel()
+		err := <-done
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	waitMounted(t, backend, "/org/freedesktop/UDisks2/block_devices/sdb2")
+
+	err = os.WriteFile(release, nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitMounted(t, backend, "/org/freedesktop/UDisks2/block_devices/dm_2d0")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, p := range []string{
+		"/org/freedesktop/UDisks2/block_devices/sdb2",
+		"/org/freedesktop/UDisks2/block_devices/dm_2d0",
+	} {
+		if !d.handled[p] {
+			t.Errorf("%s is not marked as handled", p)
+		}
+	}
+}
+
+func waitMounted(t *testing.T, backend *diskietest.Backend, objectPath dbus.ObjectPath) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		objects, err := backend.ManagedObjects(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		mountpoints, _ := objects[objectPath]["org.freedesktop.UDisks2.Filesystem"]["MountPoints"].Value().([][]byte)
+		if len(mountpoints) > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for %s to be mounted", objectPath)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/koonix/diskie"
+)
+
+// errMenuCancelled indicates that the menu exited with a non-zero status,
+// either because the user dismissed it
+// or because of a custom keybinding such as rofi's kb-custom-N.
+var errMenuCancelled = errors.New("the menu was cancelled")
+
+// exitError makes diskie exit with the given code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// menuError converts the error returned from running the menu,
+// so that diskie exits with the same code as the menu
+// if it exited with a non-zero status.
+// errors that are caused by the menu crashing are reported as-is.
+func menuError(err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fmt.Errorf("could not run the menu: %w", err)
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if ok && status.Signaled() {
+		return &exitError{
+			code: 128 + int(status.Signal()),
+			err:  fmt.Errorf("the menu crashed: %w", err),
+		}
+	}
+
+	return &exitError{
+		code: exitErr.ExitCode(),
+		err:  errMenuCancelled,
+	}
+}
+
+// handleError prints the error and returns the exit code.
+// the menu being cancelled is not reported,
+// since it's the user's choice rather than a failure.
+func handleError(err error) int {
+	if !errors.Is(err, errMenuCancelled) {
+		fmt.Fprintln(os.Stderr, err)
+		printHolders(os.Stderr, err)
+	}
+
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+
+	for _, e := range exitCodes {
+		if errors.Is(err, e.err) {
+			return e.code
+		}
+	}
+
+	return 1
+}
+
+// exitCodes lets scripts tell apart the reasons of udisks failures.
+// the codes are out of the range of rofi's kb-custom-N exit codes (10-28).
+// the first match wins, so ErrCancelled comes first:
+// a dismissed authentication dialog is both not authorized and cancelled.
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{diskie.ErrCancelled, 37},
+	{diskie.ErrNotAuthorized, 31},
+	{diskie.ErrDeviceBusy, 32},
+	{diskie.ErrAlreadyMounted, 33},
+	{diskie.ErrNotMounted, 34},
+	{diskie.ErrWrongPassphrase, 35},
+	{diskie.ErrDeviceNotFound, 36},
+	{diskie.ErrTimedOut, 38},
+	{diskie.ErrAmbiguousDevice, 39},
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/koonix/diskie"
+)
+
+func TestHandleError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"other", errors.New("failed"), 1},
+		{"not authorized", fmt.Errorf("could not mount: %w", diskie.ErrNotAuthorized), 31},
+		{"dismissed", fmt.Errorf("could not mount: %w: %w", diskie.ErrNotAuthorized, diskie.ErrCancelled), 37},
+		{"wrong passphrase", fmt.Errorf("could not unlock: %w", diskie.ErrWrongPassphrase), 35},
+		{"menu", &exitError{code: 10, err: errMenuCancelled}, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := handleError(tt.err); got != tt.want {
+				t.Errorf("got exit code %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/koonix/diskie"
+)
+
+func cmdFormat(device string, fsType string, opts diskie.FormatOptions, encrypt bool, passwordFile string, askpass []string, force bool, yes bool) error {
+	dsk, err := connect()
+	if err != nil {
+		return fmt.Errorf("could not create diskie client: %w", err)
+	}
+
+	blockmap, err := blockDevices(dsk)
+	if err != nil {
+		return fmt.Errorf("could not get block devices: %w", err)
+	}
+
+	b, err := blockmap.Resolve(device)
+	if err != nil {
+		return err
+	}
+
+	var source passwordSource
+	if encrypt {
+		source = newPasswordSource(passwordFile, askpass)
+	}
+
+	return formatDevice(dsk, b, fsType, opts, source, force, yes)
+}
+
+// formatDevice formats the device, in a LUKS container
+// whose password is read from source if it's not nil.
+// system devices are refused unless force is set,
+// and the user is asked to confirm unless yes is set.
+func formatDevice(dsk *diskie.Conn, b *diskie.BlockDevice, fsType string, opts diskie.FormatOptions, source passwordSource, force bool, yes bool) error {
+	name := deviceName(b)
+
+	if b.HintSystem != nil && *b.HintSystem && !force {
+		return fmt.Errorf("device %s is a system device; use --force to format it anyway", name)
+	}
+
+	if !yes {
+		ok, err := confirm(formatQuestion(b, fsType))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s was not formatted", diskie.ErrCancelled, name)
+		}
+	}
+
+	if source != nil {
+		password, err := newPassword(source, name)
+		if err != nil {
+			return err
+		}
+		defer zero(password)
+		opts.EncryptPassphrase = password
+	}
+
+	ctx, cancel := callContext()
+	defer cancel()
+
+	err := dsk.FormatContext(ctx, b.ObjectPath, fsType, opts)
+	if err != nil {
+		err = fmt.Errorf("could not format %s: %w", name, err)
+		notify("Could not format "+name, b, err.Error())
+		return err
+	}
+
+	notify("Formatted "+name, b, "")
+
+	return nil
+}
+
+// formatQuestion asks whether to format the device,
+// describing what's about to be destroyed.
+func formatQuestion(b *diskie.BlockDevice, fsType string) string {
+	var q strings.Builder
+
+	fmt.Fprintf(&q, "Format %s as %s?\n", deviceName(b), fsType)
+
+	if d := b.CryptoRootDrive; d != nil {
+		fmt.Fprintf(&q, "  drive:    %s\n", driveName(d))
+	}
+	if b.Size != nil {
+		fmt.Fprintf(&q, "  size:     %s\n", humanize.IBytes(*b.Size))
+	}
+	if b.IdType != nil && *b.IdType != "" {
+		contents := *b.IdType
+		if b.IdLabel != nil && *b.IdLabel != "" {
+			contents += fmt.Sprintf(" %q", *b.IdLabel)
+		}
+		fmt.Fprintf(&q, "  contents: %s\n", contents)
+	}
+
+	q.WriteString("All data on the device will be lost.")
+
+	return q.String()
+}
+
+// newPassword reads the password for a new encrypted device,
+// asking for it twice if the source is interactive.
+func newPassword(source passwordSource, name string) ([]byte, error) {
+	password, err := source.read(fmt.Sprintf("New password for %s: ", name))
+	if err != nil {
+		return nil, err
+	}
+	if len(password) == 0 {
+		return nil, fmt.Errorf("the password is empty")
+	}
+
+	if !source.interactive() {
+		return password, nil
+	}
+
+	again, err := source.read(fmt.Sprintf("Repeat the password for %s: ", name))
+	if err != nil {
+		zero(password)
+		return nil, err
+	}
+	defer zero(again)
+
+	if !bytes.Equal(password, again) {
+		zero(password)
+		return nil, fmt.Errorf("the passwords do not match")
+	}
+
+	return password, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie"
+	"github.com/koonix/diskie/diskietest"
+)
+
+const formatMethod = "org.freedesktop.UDisks2.Block.Format"
+
+// formatFixture returns the device of the fixture, resolved through a recording backend.
+func formatFixture(t *testing.T, fixture string, device string) (*recordingBackend, *diskie.Conn, *diskie.BlockDevice) {
+	t.Helper()
+
+	backend, err := diskietest.Load("../../diskietest/fixtures/" + fixture + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &recordingBackend{Backend: backend}
+	dsk := diskie.NewConn(rec)
+
+	blockmap, err := dsk.BlockDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := blockmap.Resolve(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rec, dsk, b
+}
+
+func TestFormatRefusesSystemDevices(t *testing.T) {
+	rec, dsk, b := formatFixture(t, "luks-on-lvm", "/dev/nvme0n1p1")
+
+	err := formatDevice(dsk, b, "vfat", diskie.FormatOptions{}, nil, false, true)
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("got error %v, want a refusal that mentions --force", err)
+	}
+	if _, called := rec.find(formatMethod); called {
+		t.Error("the system device was formatted without --force")
+	}
+
+	// the partition is mounted
+	err = formatDevice(dsk, b, "vfat", diskie.FormatOptions{TearDown: true}, nil, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, called := rec.find(formatMethod); !called {
+		t.Error("the system device was not formatted with --force")
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	rec, dsk, b := formatFixture(t, "luks-in-partition", "/dev/sdb2")
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	err := os.WriteFile(passwordFile, []byte("hunter2\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := diskie.FormatOptions{
+		Label:         "DATA",
+		EncryptType:   "luks2",
+		TearDown:      true,
+		TakeOwnership: true,
+	}
+
+	err = formatDevice(dsk, b, "ext4", opts, newPasswordSource(passwordFile, nil), false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args, called := rec.find(formatMethod)
+	if !called {
+		t.Fatal("Format was not called")
+	}
+	if args[0] != "ext4" {
+		t.Errorf("got type %v, want ext4", args[0])
+	}
+
+	options := args[1].(map[string]dbus.Variant)
+
+	passphrase, ok := options["encrypt.passphrase"].Value().([]byte)
+	if !ok || string(passphrase) != "hunter2" {
+		t.Errorf("got encrypt.passphrase %v, want the password as bytes", options["encrypt.passphrase"])
+	}
+
+	want := map[string]any{
+		"label":          "DATA",
+		"encrypt.type":   "luks2",
+		"tear-down":      true,
+		"take-ownership": true,
+	}
+	for k, v := range want {
+		if got := options[k].Value(); got != v {
+			t.Errorf("got %s %v, want %v", k, got, v)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/koonix/diskie"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// the snapshots in testdata are the json-map output of print for the fixtures of diskietest,
+// and the output of each format for them is kept in a golden file next to them.
+func TestFormats(t *testing.T) {
+	snapshots, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) == 0 {
+		t.Fatal("no snapshots in testdata")
+	}
+
+	for _, snapshot := range snapshots {
+		for _, format := range []string{"tabular", "basic", "rofi-markup"} {
+			name := strings.TrimSuffix(snapshot, ".json") + "." + format
+			t.Run(filepath.Base(name), func(t *testing.T) {
+				data, err := os.ReadFile(snapshot)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				blockmap, err := diskie.ParseSnapshot(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				tmpl, err := readFormat(format)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				formatted, _, err := formatBlocks(blockmap.Sort(), tmpl, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got := strings.Join(formatted, "\n") + "\n"
+
+				golden := name + ".golden"
+
+				if *update {
+					err := os.WriteFile(golden, []byte(got), 0o644)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got != string(want) {
+					t.Errorf("output does not match %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+				}
+			})
+		}
+	}
+}
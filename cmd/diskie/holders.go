@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/koonix/diskie"
+)
+
+// printHolders prints the processes that keep the filesystem busy,
+// if err is caused by a busy filesystem.
+func printHolders(w io.Writer, err error) {
+	var busy *diskie.BusyError
+	if !errors.As(err, &busy) || len(busy.Holders) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "%s is used by:\n", strings.Join(busy.MountPoints, ", "))
+	for _, h := range busy.Holders {
+		fmt.Fprintf(w, "  %d (%s): %s\n", h.PID, h.Command, strings.Join(h.Paths, ", "))
+	}
+}
+
+// offerKill offers to terminate the processes that keep the filesystem busy,
+// if err is caused by a busy filesystem,
+// and reports whether they were terminated.
+func offerKill(err error) bool {
+	var busy *diskie.BusyError
+	if !errors.As(err, &busy) || len(busy.Holders) == 0 {
+		return false
+	}
+
+	var question strings.Builder
+	printHolders(&question, err)
+	question.WriteString("Send SIGTERM to these processes?")
+
+	ok, err := confirm(question.String())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	for _, h := range busy.Holders {
+		err := syscall.Kill(h.PID, syscall.SIGTERM)
+		if err != nil && !errors.Is(err, syscall.ESRCH) {
+			fmt.Fprintf(os.Stderr, "could not terminate process %d (%s): %v\n", h.PID, h.Command, err)
+		}
+	}
+
+	// give the processes a moment to exit
+	for range 50 {
+		alive := false
+		for _, h := range busy.Holders {
+			if syscall.Kill(h.PID, 0) == nil {
+				alive = true
+			}
+		}
+		if !alive {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return true
+}
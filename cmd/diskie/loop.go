@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/koonix/diskie"
+)
+
+// loopScanTimeout limits how long loop-mount waits for udisks
+// to add the partitions of the loop device after setting it up.
+const loopScanTimeout = 5 * time.Second
+
+func cmdLoopMount(file string, opts diskie.LoopOptions) error {
+	dsk, err := connect()
+	if err != nil {
+		return fmt.Errorf("could not create diskie client: %w", err)
+	}
+
+	b, mountpoints, err := loopSetupMount(dsk, file, opts)
+	if err != nil {
+		notify("Could not mount "+file, b, err.Error())
+		return err
+	}
+
+	for _, mp := range mountpoints {
+		fmt.Println(mp)
+	}
+
+	notify("Mounted "+file, b, strings.Join(mountpoints, "\n"))
+
+	return nil
+}
+
+// loopSetupMount sets up a loop device for the file,
+// waits for udisks to add its partitions, and mounts them (see loopMount).
+// it returns the loop device if it was set up.
+func loopSetupMount(dsk *diskie.Conn, file string, opts diskie.LoopOptions) (*diskie.BlockDevice, []string, error) {
+	// watch before setting up the loop device, so that no change is missed
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+
+	events, err := dsk.Watch(watchCtx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not watch block devices: %w", err)
+	}
+
+	ctx, cancel := callContext()
+	defer cancel()
+
+	loop, err := dsk.LoopSetupContext(ctx, file, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not set up a loop device for %s: %w", file, err)
+	}
+
+	blockmap, err := blockDevices(dsk)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get block devices: %w", err)
+	}
+
+	// udisks adds the partition table and the partitions of the loop device
+	// once the kernel has scanned them, after LoopSetup has returned.
+	// if they don't show up in time, what's there is mounted.
+	timeout := time.After(loopScanTimeout)
+	for waiting := true; waiting && !loopScanned(blockmap, loop, opts.NoPartScan); {
+		select {
+		case event := <-events:
+			blockmap = event.BlockMap
+		case <-timeout:
+			waiting = false
+		}
+	}
+
+	b, has := blockmap.BlockMap[loop]
+	if !has {
+		return nil, nil, fmt.Errorf("loop device not found in the list of devices: %s", loop)
+	}
+
+	mountpoints, err := loopMount(dsk, blockmap, b)
+	if err != nil {
+		return b, nil, err
+	}
+
+	return b, mountpoints, nil
+}
+
+// loopScanned reports whether udisks is done adding the loop device:
+// whether there's a filesystem or an encrypted device on it,
+// or a partition table whose partitions are all present.
+func loopScanned(blockmap *diskie.BlockMap, loop string, noPartScan bool) bool {
+	b, has := blockmap.BlockMap[loop]
+	if !has {
+		return false
+	}
+	if noPartScan || b.Filesystem != nil || b.Encrypted != nil {
+		return true
+	}
+
+	t := b.PartitionTable
+	if t == nil || t.Partitions == nil || len(*t.Partitions) == 0 {
+		return false
+	}
+	for _, p := range *t.Partitions {
+		_, has := blockmap.BlockMap[p]
+		if !has {
+			return false
+		}
+	}
+	return true
+}
+
+// loopMount mounts the filesystem of the loop device, or those of its partitions,
+// and returns their mountpoints.
+// encrypted partitions are left as they are.
+// if there's no filesystem to mount, or one of them fails to mount,
+// the loop device is deleted, which unmounts those that were mounted.
+func loopMount(dsk *diskie.Conn, blockmap *diskie.BlockMap, loop *diskie.BlockDevice) ([]string, error) {
+	var mountpoints []string
+
+	for _, b := range append([]*diskie.BlockDevice{loop}, blockmap.PartitionsOf(loop)...) {
+		if b.Filesystem == nil {
+			continue
+		}
+		_, mp, err := attach(dsk, blockmap, b, nil, 0, false, diskie.MountOptions{})
+		if err != nil {
+			return nil, loopRollback(dsk, loop, mountpoints, err)
+		}
+		mountpoints = append(mountpoints, mp)
+	}
+
+	if len(mountpoints) > 0 {
+		return mountpoints, nil
+	}
+
+	ctx, cancel := callContext()
+	defer cancel()
+
+	err := dsk.LoopDeleteContext(ctx, loop.ObjectPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not delete %s, which contains no filesystem: %w", deviceName(loop), err)
+	}
+
+	name := deviceName(loop)
+	if l := loop.Loop; l != nil && l.BackingFile != nil && *l.BackingFile != "" {
+		name = *l.BackingFile
+	}
+
+	return nil, fmt.Errorf("%s contains no filesystem", name)
+}
+
+// loopRollback deletes the loop device after mounting one of its filesystems failed with err.
+// the filesystems that were mounted before the failure are unmounted,
+// or reported if the loop device can't be deleted.
+func loopRollback(dsk *diskie.Conn, loop *diskie.BlockDevice, mountpoints []string, err error) error {
+	blockmap, e := blockDevices(dsk)
+	if e == nil {
+		b, has := blockmap.BlockMap[loop.ObjectPath]
+		if has {
+			e = loopDelete(dsk, blockmap, b)
+		}
+	}
+
+	if e != nil && len(mountpoints) > 0 {
+		return fmt.Errorf("%w (%s is left mounted at %s: %v)", err, deviceName(loop), strings.Join(mountpoints, ", "), e)
+	} else if e != nil {
+		return fmt.Errorf("%w (%s is left set up: %v)", err, deviceName(loop), e)
+	}
+
+	return err
+}
+
+func cmdLoopDelete(device string, kill bool) error {
+	dsk, err := connect()
+	if err != nil {
+		return fmt.Errorf("could not create diskie client: %w", err)
+	}
+
+	blockmap, err := blockDevices(dsk)
+	if err != nil {
+		return fmt.Errorf("could not get block devices: %w", err)
+	}
+
+	b, err := blockmap.Resolve(device)
+	if err != nil {
+		return err
+	}
+
+	// partitions of loop devices stand for their loop device
+	if b.Loop == nil && b.Partition != nil {
+		if p := blockmap.Parent(b); p != nil {
+			b = p
+		}
+	}
+	if b.Loop == nil {
+		return fmt.Errorf("device %s is not a loop device", deviceName(b))
+	}
+
+	err = loopDelete(dsk, blockmap, b)
+	if err != nil && kill && offerKill(err) {
+		blockmap, err = blockDevices(dsk)
+		if err != nil {
+			return fmt.Errorf("could not get block devices: %w", err)
+		}
+		err = loopDelete(dsk, blockmap, b)
+	}
+	if err != nil {
+		notify("Could not delete "+deviceName(b), b, err.Error())
+		return err
+	}
+
+	file := ""
+	if b.Loop.BackingFile != nil {
+		file = *b.Loop.BackingFile
+	}
+
+	notify("Deleted "+deviceName(b), b, file)
+
+	return nil
+}
+
+// loopDelete unmounts the filesystems and locks the encrypted devices
+// on the loop device and its partitions, then deletes the loop device.
+func loopDelete(dsk *diskie.Conn, blockmap *diskie.BlockMap, loop *diskie.BlockDevice) error {
+	name := deviceName(loop)
+
+	for _, b := range append([]*diskie.BlockDevice{loop}, blockmap.PartitionsOf(loop)...) {
+		if !inUse(blockmap, b) {
+			continue
+		}
+		err := detach(dsk, blockmap, b, true)
+		if err != nil {
+			return fmt.Errorf("could not delete %s: %w", name, err)
+		}
+	}
+
+	ctx, cancel := callContext()
+	defer cancel()
+
+	err := dsk.LoopDeleteContext(ctx, loop.ObjectPath)
+	if err != nil {
+		return fmt.Errorf("could not delete %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// inUse reports whether the filesystem on top of the device is mounted,
+// or the device is unlocked.
+func inUse(blockmap *diskie.BlockMap, b *diskie.BlockDevice) bool {
+	e := b.Encrypted
+	if e != nil && e.CleartextDevice != nil && *e.CleartextDevice != "/" {
+		return true
+	}
+	closing, has := blockmap.BlockMap[b.CryptoClosingDevice]
+	if !has || closing.Filesystem == nil {
+		return false
+	}
+	mp := closing.Filesystem.MountPoints
+	return mp != nil && len(*mp) > 0
+}
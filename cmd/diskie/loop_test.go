@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie"
+	"github.com/koonix/diskie/diskietest"
+)
+
+// failingMountBackend fails to mount the filesystems whose object path has the given suffix.
+type failingMountBackend struct {
+	*diskietest.Backend
+	suffix string
+}
+
+func (f *failingMountBackend) Call(ctx context.Context, objectPath dbus.ObjectPath, method string, args []any, ret ...any) error {
+	if method == "org.freedesktop.UDisks2.Filesystem.Mount" && strings.HasSuffix(string(objectPath), f.suffix) {
+		return dbus.Error{
+			Name: "org.freedesktop.UDisks2.Error.Failed",
+			Body: []any{"Error mounting " + string(objectPath) + ": wrong fs type"},
+		}
+	}
+	return f.Backend.Call(ctx, objectPath, method, args, ret...)
+}
+
+// diskImage creates the disk image of the loop fixture, disk.img, with two partitions.
+func diskImage(t *testing.T) (*diskietest.Backend, string) {
+	t.Helper()
+
+	backend, err := diskietest.Load("../../diskietest/fixtures/loop.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "disk.img")
+	err = os.WriteFile(file, make([]byte, 4096), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return backend, file
+}
+
+func TestLoopMountWaitsForPartitions(t *testing.T) {
+	backend, file := diskImage(t)
+	backend.SetPartitionScanDelay(100 * time.Millisecond)
+
+	_, mountpoints, err := loopSetupMount(diskie.NewConn(backend), file, diskie.LoopOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/run/media/diskie/BOOT", "/run/media/diskie/root"}
+	if !slices.Equal(mountpoints, want) {
+		t.Errorf("got mountpoints %v, want %v", mountpoints, want)
+	}
+}
+
+func TestLoopMountRollsBack(t *testing.T) {
+	backend, file := diskImage(t)
+	dsk := diskie.NewConn(&failingMountBackend{Backend: backend, suffix: "p2"})
+
+	_, mountpoints, err := loopSetupMount(dsk, file, diskie.LoopOptions{})
+	if err == nil {
+		t.Fatalf("loopSetupMount succeeded with mountpoints %v", mountpoints)
+	}
+	if !strings.Contains(err.Error(), "wrong fs type") {
+		t.Errorf("the error doesn't tell why the mount failed: %v", err)
+	}
+
+	bm, err := dsk.BlockDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range bm.BlockMap {
+		if b.Loop != nil && b.Loop.BackingFile != nil && *b.Loop.BackingFile == file {
+			t.Errorf("the loop device %s is left set up", b.ObjectPath)
+		}
+		fs := b.Filesystem
+		if fs != nil && fs.MountPoints != nil && slices.Contains(*fs.MountPoints, "/run/media/diskie/BOOT") {
+			t.Errorf("%s is left mounted", b.ObjectPath)
+		}
+	}
+}
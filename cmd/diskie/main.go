@@ -2,27 +2,430 @@ package main
 
 import (
 	"bytes"
-	"diskie"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/Masterminds/sprig/v3"
+	"github.com/koonix/diskie"
 	"github.com/urfave/cli"
 )
 
+var shortNumericOptionRegex = regexp.MustCompile(`^-[lL][0-9]+$`)
+
+// set at build time using -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
 	app := &cli.App{
-		Name:  "diskie",
-		Usage: "Command line tool for UDisks2",
+		Name:    "diskie",
+		Usage:   "Command line tool for UDisks2",
+		Version: version,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "notify, n",
+				Usage: "Send desktop notifications about the results of actions and device events.",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout, t",
+				Usage: "Give up on each call to udisks after the given duration (e.g. 30s). Zero means no timeout.",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			timeout = c.Duration("timeout")
+			if c.Bool("notify") {
+				return setupNotifier()
+			}
+			return nil
+		},
 		Commands: []cli.Command{
 			{
-				Name:  "blockdevs",
-				Usage: "Print block devices.",
+				Name:  "print",
+				Usage: "Print the available block devices.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format, f",
+						Value: "json-array",
+						Usage: `Output format. Can be "json-array", "json-map", "tabular", "basic", "rofi-markup" or "template:FILE_PATH".`,
+					},
+					&cli.UintFlag{
+						Name:  "limit, l",
+						Value: 0,
+						Usage: "Filter out less significant devices. Possible values are 0 through 3.",
+					},
+					&cli.StringFlag{
+						Name:  "from-snapshot",
+						Usage: "Read the devices from the JSON output of print instead of udisks.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					f := c.String("format")
+					l := c.Uint("limit")
+					n := c.String("from-snapshot")
+					if l > 3 {
+						return fmt.Errorf("limit of %d is out of the possible range of 0 through 3", l)
+					}
+					return cmdPrint(f, l, n)
+				},
+			},
+			{
+				Name:      "select",
+				Usage:     "Select a device using a dmenu-compatible program and print its object path.",
+				UsageText: "select [command options] [--] menu_cmd [arguments...]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format, f",
+						Value: "basic",
+						Usage: `Menu format. Can be "tabular", "basic", "rofi-markup" or "template:FILE_PATH".`,
+					},
+					&cli.UintFlag{
+						Name:  "limit, l",
+						Value: 2,
+						Usage: "Filter out less significant devices. Possible values are 0 through 3.",
+					},
+					&cli.UintFlag{
+						Name:  "menu-max-lines, L",
+						Value: 0,
+						Usage: "Limit the maximum value of the %l sequence. Zero means no limit.",
+					},
+					&cli.StringFlag{
+						Name:  "from-snapshot",
+						Usage: "Read the devices from the JSON output of print instead of udisks.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					menuCmd := c.Args().First()
+					menuArgs := c.Args().Tail()
+					f := c.String("format")
+					l := c.Uint("limit")
+					m := c.Uint("menu-max-lines")
+					n := c.String("from-snapshot")
+					if l > 3 {
+						return fmt.Errorf("limit of %d is out of the possible range of 0 through 3", l)
+					}
+					if menuCmd == "" {
+						return fmt.Errorf("please provide a dmenu-compatible program as the arguments to this command (eg. `diskie select -- dmenu -p Diskie`)")
+					}
+					return cmdSelect(f, l, m, menuCmd, menuArgs, n, false)
+				},
+			},
+			{
+				Name:      "mount",
+				Usage:     "Mount a filesystem and print its mountpoint.",
+				UsageText: "mount [command options] [--] device [askpass_cmd [arguments...]]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "password-file, p",
+						Usage: "Read the password from the given file.",
+					},
+					&cli.UintFlag{
+						Name:  "password-attempts",
+						Value: 3,
+						Usage: "Ask for the password again if it's wrong, up to the given number of attempts.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					device := c.Args().First()
+					askpass := c.Args().Tail()
+					p := c.String("password-file")
+					a := c.Uint("password-attempts")
+					if device == "" {
+						return fmt.Errorf("please provide a device as the first argument to this command")
+					}
+					return cmdAttach(device, p, askpass, a, false, false, nil)
+				},
+			},
+			{
+				Name:      "attach",
+				Usage:     "Unlock a device if it's encrypted, then mount it and print its mountpoint.",
+				UsageText: "attach [command options] [--] device [askpass_cmd [arguments...]]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "password-file, p",
+						Usage: "Read the password from the given file.",
+					},
+					&cli.UintFlag{
+						Name:  "password-attempts",
+						Value: 3,
+						Usage: "Ask for the password again if it's wrong, up to the given number of attempts.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					device := c.Args().First()
+					askpass := c.Args().Tail()
+					p := c.String("password-file")
+					a := c.Uint("password-attempts")
+					if device == "" {
+						return fmt.Errorf("please provide a device as the first argument to this command")
+					}
+					return cmdAttach(device, p, askpass, a, true, false, nil)
+				},
+			},
+			{
+				Name:      "open",
+				Usage:     "Same as attach, but open the mountpoint after mounting the device.",
+				UsageText: "open [command options] [--] device [askpass_cmd [arguments...]]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "password-file, p",
+						Usage: "Read the password from the given file.",
+					},
+					&cli.UintFlag{
+						Name:  "password-attempts",
+						Value: 3,
+						Usage: "Ask for the password again if it's wrong, up to the given number of attempts.",
+					},
+					&cli.StringFlag{
+						Name:  "opener",
+						Value: "xdg-open",
+						Usage: "Command used to open the mountpoint if no file manager implements org.freedesktop.FileManager1.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					device := c.Args().First()
+					askpass := c.Args().Tail()
+					p := c.String("password-file")
+					a := c.Uint("password-attempts")
+					o := strings.Fields(c.String("opener"))
+					if device == "" {
+						return fmt.Errorf("please provide a device as the first argument to this command")
+					}
+					return cmdAttach(device, p, askpass, a, true, true, o)
+				},
+			},
+			{
+				Name:      "unmount",
+				Usage:     "Unmount a filesystem.",
+				UsageText: "unmount [command options] [--] device",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "kill",
+						Usage: "If the filesystem is busy, offer to terminate the processes that are using it, then try again.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					device := c.Args().First()
+					if device == "" {
+						return fmt.Errorf("please provide a device as the first argument to this command")
+					}
+					return cmdDetach(device, false, c.Bool("kill"))
+				},
+			},
+			{
+				Name:      "detach",
+				Usage:     "Unmount a filesystem, then lock it if it's encrypted.",
+				UsageText: "detach [command options] [--] device",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "kill",
+						Usage: "If the filesystem is busy, offer to terminate the processes that are using it, then try again.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					device := c.Args().First()
+					if device == "" {
+						return fmt.Errorf("please provide a device as the first argument to this command")
+					}
+					return cmdDetach(device, true, c.Bool("kill"))
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     "Unmount and lock everything on the drive of a device, then power off or eject the drive.",
+				UsageText: "remove [command options] [--] device",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "kill",
+						Usage: "If the filesystem is busy, offer to terminate the processes that are using it, then try again.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					device := c.Args().First()
+					if device == "" {
+						return fmt.Errorf("please provide a device as the first argument to this command")
+					}
+					return cmdRemove(device, c.Bool("kill"))
+				},
+			},
+			{
+				Name:      "loop-mount",
+				Usage:     "Set up a loop device for a disk image, mount its filesystems and print their mountpoints.",
+				UsageText: "loop-mount [command options] [--] file",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "read-only, r",
+						Usage: "Set up a read-only loop device.",
+					},
+					&cli.Uint64Flag{
+						Name:  "offset",
+						Usage: "Start the loop device at the given byte offset of the file.",
+					},
+					&cli.Uint64Flag{
+						Name:  "size",
+						Usage: "Limit the loop device to the given number of bytes of the file.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					file := c.Args().First()
+					if file == "" {
+						return fmt.Errorf("please provide a file as the first argument to this command")
+					}
+					return cmdLoopMount(file, diskie.LoopOptions{
+						ReadOnly: c.Bool("read-only"),
+						Offset:   c.Uint64("offset"),
+						Size:     c.Uint64("size"),
+					})
+				},
+			},
+			{
+				Name:      "loop-delete",
+				Usage:     "Unmount and lock everything on a loop device, then delete it.",
+				UsageText: "loop-delete [command options] [--] device",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "kill",
+						Usage: "If a filesystem is busy, offer to terminate the processes that are using it, then try again.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					device := c.Args().First()
+					if device == "" {
+						return fmt.Errorf("please provide a device as the first argument to this command")
+					}
+					return cmdLoopDelete(device, c.Bool("kill"))
+				},
+			},
+			{
+				Name:      "format",
+				Usage:     "Create a new filesystem on a device, optionally inside an encrypted container.",
+				UsageText: "format [command options] [--] device [askpass_cmd [arguments...]]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "type",
+						Value: "ext4",
+						Usage: `Filesystem type, e.g. "ext4", "vfat" or "exfat". "dos" or "gpt" create an empty partition table.`,
+					},
+					&cli.StringFlag{
+						Name:  "label",
+						Usage: "Label of the new filesystem.",
+					},
+					&cli.StringFlag{
+						Name:  "erase",
+						Usage: `Erase the existing data first. Can be "zero", "ata-secure-erase" or "ata-secure-erase-enhanced".`,
+					},
+					&cli.BoolFlag{
+						Name:  "encrypt, e",
+						Usage: "Put the filesystem inside a LUKS container.",
+					},
+					&cli.StringFlag{
+						Name:  "encrypt-type",
+						Usage: `Type of the LUKS container. Can be "luks1" or "luks2".`,
+					},
+					&cli.StringFlag{
+						Name:  "password-file, p",
+						Usage: "Read the password of the LUKS container from the given file.",
+					},
+					&cli.BoolFlag{
+						Name:  "take-ownership",
+						Usage: "Make the current user the owner of the new filesystem.",
+					},
+					&cli.BoolFlag{
+						Name:  "tear-down",
+						Usage: "Unmount and lock everything on the device first.",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Format the device even if it's a system device.",
+					},
+					&cli.BoolFlag{
+						Name:  "yes, y",
+						Usage: "Don't ask for confirmation.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					device := c.Args().First()
+					askpass := c.Args().Tail()
+					if device == "" {
+						return fmt.Errorf("please provide a device as the first argument to this command")
+					}
+					opts := diskie.FormatOptions{
+						Label:         c.String("label"),
+						Erase:         c.String("erase"),
+						EncryptType:   c.String("encrypt-type"),
+						TakeOwnership: c.Bool("take-ownership"),
+						TearDown:      c.Bool("tear-down"),
+					}
+					return cmdFormat(device, c.String("type"), opts, c.Bool("encrypt"), c.String("password-file"), askpass, c.Bool("force"), c.Bool("yes"))
+				},
+			},
+			{
+				Name:  "watch",
+				Usage: "Print a line for every block device event.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format, f",
+						Value: "json",
+						Usage: `Output format. Can be "json", "tabular", "basic", "rofi-markup" or "template:FILE_PATH".`,
+					},
+					&cli.UintFlag{
+						Name:  "limit, l",
+						Value: 0,
+						Usage: "Filter out events of less significant devices. Possible values are 0 through 3.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					f := c.String("format")
+					l := c.Uint("limit")
+					if l > 3 {
+						return fmt.Errorf("limit of %d is out of the possible range of 0 through 3", l)
+					}
+					return cmdWatch(f, l)
+				},
+			},
+			{
+				Name:      "daemon",
+				Usage:     "Automatically mount devices as they're added.",
+				UsageText: "daemon [command options] [--] [askpass_cmd [arguments...]]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "rules, r",
+						Usage: "Read the rules from the given JSON file instead of $XDG_CONFIG_HOME/diskie/rules.json.",
+					},
+					&cli.StringFlag{
+						Name:  "ask-cmd",
+						Usage: `dmenu-compatible command used for rules with the "ask" action. %d is replaced with the device.`,
+					},
+					&cli.StringFlag{
+						Name:  "password-file, p",
+						Usage: "Read the password from the given file.",
+					},
+					&cli.UintFlag{
+						Name:  "password-attempts",
+						Value: 3,
+						Usage: "Ask for the password again if it's wrong, up to the given number of attempts.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					askpass := c.Args()
+					r := c.String("rules")
+					k := strings.Fields(c.String("ask-cmd"))
+					p := c.String("password-file")
+					a := c.Uint("password-attempts")
+					return cmdDaemon(r, p, askpass, a, k)
+				},
+			},
+			{
+				Name:   "blockdevs",
+				Usage:  `Deprecated alias of "print".`,
+				Hidden: true,
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:  "format",
@@ -39,25 +442,41 @@ func main() {
 						Value: "array",
 						Usage: `Type of the JSON output. Can be "array" or "object".`,
 					},
+					&cli.StringFlag{
+						Name:  "from-snapshot",
+						Usage: "Read the devices from the JSON output of print instead of udisks.",
+					},
 				},
 				Action: func(c *cli.Context) error {
+					deprecated("blockdevs", "print")
 					f := c.String("format")
 					t := c.String("json-type")
 					i := c.Uint("min-importance")
+					n := c.String("from-snapshot")
 					if i > 3 {
 						return fmt.Errorf("min-importance of %d is out of the possible range of 0 through 3", i)
 					}
-					return cmdBlockdevs(f, t, i)
+					if f == "json" && t == "array" {
+						f = "json-array"
+					} else if f == "json" && t == "object" {
+						f = "json-map"
+					} else if f == "json" {
+						return fmt.Errorf("unknown jsonType: %s", t)
+					} else {
+						f = legacyFormat(f)
+					}
+					return cmdPrint(f, i, n)
 				},
 			},
 			{
 				Name:      "menu",
-				Usage:     "Mount or unmount devices using a dmenu-compatible program.",
+				Usage:     `Deprecated alias of "select".`,
 				UsageText: "menu [command options] cmd [arguments...]",
+				Hidden:    true,
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:  "format",
-						Value: "default",
+						Value: "basic",
 						Usage: `Output format. Can be "tabular", "basic", "rofi-markup" or path to a file containing a golang template.`,
 					},
 					&cli.UintFlag{
@@ -65,52 +484,55 @@ func main() {
 						Value: 0,
 						Usage: "Only include block devices more important than the given level. Possible values are 0 through 3.",
 					},
-					&cli.StringFlag{
+					&cli.UintFlag{
 						Name:  "max-lines",
-						Value: "0",
+						Value: 0,
 						Usage: "Limit the maximum value of the %l sequence. Zero means no limit.",
 					},
+					&cli.StringFlag{
+						Name:  "from-snapshot",
+						Usage: "Read the devices from the JSON output of print instead of udisks.",
+					},
 				},
 				Action: func(c *cli.Context) error {
+					deprecated("menu", "select")
 					menuCmd := c.Args().First()
 					menuArgs := c.Args().Tail()
-					f := c.String("format")
+					f := legacyFormat(c.String("format"))
 					i := c.Uint("min-importance")
 					l := c.Uint("max-lines")
+					n := c.String("from-snapshot")
 					if i > 3 {
 						return fmt.Errorf("min-importance of %d is out of the possible range of 0 through 3", i)
 					}
 					if menuCmd == "" && len(menuArgs) == 0 {
 						return fmt.Errorf("please provide a dmenu-compatible program as the arguments to this command (eg. `diskie menu dmenu -p Diskie`)")
 					}
-					return cmdMenu(f, i, l, menuCmd, menuArgs)
+					return cmdSelect(f, i, l, menuCmd, menuArgs, n, true)
 				},
 			},
 		},
 	}
 
-	err := app.Run(os.Args)
+	err := app.Run(expandShortOptions(app, os.Args))
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(handleError(err))
 	}
 }
 
-func cmdBlockdevs(format string, jsonType string, importance uint) error {
-	blocks, blockmap, err := blocks(importance)
+func cmdPrint(format string, limit uint, snapshot string) error {
+	blocks, blockmap, err := blocks(limit, snapshot)
 	if err != nil {
 		return err
 	}
 
-	if format == "json" {
+	if format == "json-array" || format == "json-map" {
 		var v any
 
-		if jsonType == "array" {
+		if format == "json-array" {
 			v = blocks
-		} else if jsonType == "object" {
-			v = blockmap
 		} else {
-			return fmt.Errorf("unknown jsonType: %s", jsonType)
+			v = blockmap
 		}
 
 		pretty, err := prettyJson(v)
@@ -120,21 +542,14 @@ func cmdBlockdevs(format string, jsonType string, importance uint) error {
 
 		fmt.Println(string(pretty))
 		return nil
-	} else if format == "tabular" {
-		format = formatTabular
-	} else if format == "basic" {
-		format = formatBasic
-	} else if format == "rofi-markup" {
-		format = formatRofiMarkup
-	} else {
-		f, err := os.ReadFile(format)
-		if err != nil {
-			return fmt.Errorf("could not read the format file: %w", err)
-		}
-		format = string(f)
 	}
 
-	formattedSlice, _, err := formatBlocks(blocks, format, false)
+	tmpl, err := readFormat(format)
+	if err != nil {
+		return err
+	}
+
+	formattedSlice, _, err := formatBlocks(blocks, tmpl, false)
 	if err != nil {
 		return err
 	}
@@ -143,27 +558,18 @@ func cmdBlockdevs(format string, jsonType string, importance uint) error {
 	return nil
 }
 
-func cmdMenu(format string, importance uint, maxlines uint, menuCmd string, menuArgs []string) error {
-	blocks, _, err := blocks(importance)
+func cmdSelect(format string, limit uint, maxlines uint, menuCmd string, menuArgs []string, snapshot string, printJson bool) error {
+	blocks, _, err := blocks(limit, snapshot)
 	if err != nil {
 		return err
 	}
 
-	if format == "tabular" {
-		format = formatTabular
-	} else if format == "basic" {
-		format = formatBasic
-	} else if format == "rofi-markup" {
-		format = formatRofiMarkup
-	} else {
-		f, err := os.ReadFile(format)
-		if err != nil {
-			return fmt.Errorf("could not read the format file: %w", err)
-		}
-		format = string(f)
+	tmpl, err := readFormat(format)
+	if err != nil {
+		return err
 	}
 
-	formattedSlice, formattedMap, err := formatBlocks(blocks, format, true)
+	formattedSlice, formattedMap, err := formatBlocks(blocks, tmpl, true)
 	if err != nil {
 		return err
 	}
@@ -177,79 +583,182 @@ func cmdMenu(format string, importance uint, maxlines uint, menuCmd string, menu
 		menuArgs[i] = strings.ReplaceAll(menuArgs[i], "%l", linesStr)
 	}
 
+	var output bytes.Buffer
+
 	cmd := exec.Command(menuCmd, menuArgs...)
+	cmd.Stdin = strings.NewReader(strings.Join(formattedSlice, "\n"))
+	cmd.Stdout = &output
 
 	// connect the command's stderr to the terminal.
 	// this is required for something like fzf to work.
 	cmd.Stderr = os.Stderr
 
-	stdin, err := cmd.StdinPipe()
+	err = cmd.Run()
 	if err != nil {
-		return fmt.Errorf("could not connect to the menu's stdin: %w", err)
+		return menuError(err)
 	}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("could not connect to the menu's stdout: %w", err)
-	}
+	selected, has := formattedMap[strings.TrimSuffix(output.String(), "\n")]
 
-	err = cmd.Start()
-	if err != nil {
-		return fmt.Errorf("could not run the menu: %w", err)
+	if printJson {
+		pretty, err := prettyJson(selected)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(pretty))
+		return nil
 	}
 
-	_, err = stdin.Write([]byte(strings.Join(formattedSlice, "\n")))
-	if err != nil {
-		return fmt.Errorf("could not write to the menu's stdin: %w", err)
+	if !has {
+		return fmt.Errorf("the selection does not match any device")
 	}
-	stdin.Close()
 
-	var output bytes.Buffer
+	fmt.Println(selected.ObjectPath)
+	return nil
+}
 
-	go func() {
-		defer stdout.Close()
-		io.Copy(&output, stdout)
+// readFormat returns the template of the given non-json format.
+func readFormat(format string) (string, error) {
+	switch {
+	case format == "tabular":
+		return formatTabular, nil
+	case format == "basic":
+		return formatBasic, nil
+	case format == "rofi-markup":
+		return formatRofiMarkup, nil
+	case strings.HasPrefix(format, "template:"):
+		path, err := expandTilde(strings.TrimPrefix(format, "template:"))
+		if err != nil {
+			return "", err
+		}
+		f, err := os.ReadFile(path)
 		if err != nil {
-			panic(fmt.Errorf("could not read from the menu's stdout: %w", err))
+			return "", fmt.Errorf("could not read the format file: %w", err)
 		}
-	}()
+		return string(f), nil
+	default:
+		return "", fmt.Errorf("unknown format: %s", format)
+	}
+}
 
-	err = cmd.Wait()
-	if err != nil {
-		return fmt.Errorf("the menu command failed: %w", err)
+// legacyFormat converts a format of the deprecated commands,
+// where anything other than a builtin format is a file path,
+// to its current equivalent.
+func legacyFormat(format string) string {
+	switch format {
+	case "tabular", "basic", "rofi-markup":
+		return format
+	default:
+		return "template:" + format
 	}
+}
 
-	selected := formattedMap[strings.TrimSuffix(output.String(), "\n")]
-	pretty, err := prettyJson(selected)
+func expandTilde(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
 	if err != nil {
-		return err
+		return "", fmt.Errorf("could not expand the tilde in %s: %w", path, err)
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+// expandShortOptions rewrites numeric short options
+// that have their value attached (eg. -l3) into -l=3,
+// which is the form that the flag package understands.
+// only the options of the command that come before its first argument are rewritten,
+// so that the arguments of the menu and askpass commands are passed on as they are.
+func expandShortOptions(app *cli.App, args []string) []string {
+	expanded := slices.Clone(args)
+
+	i := skipOptions(app.Flags, args, 1)
+	if i >= len(args) {
+		return expanded
 	}
 
-	fmt.Println(string(pretty))
+	cmd := app.Command(args[i])
+	if cmd == nil {
+		return expanded
+	}
+
+	for i++; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "-" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		if shortNumericOptionRegex.MatchString(arg) && lookupFlag(cmd.Flags, arg[:2]) != nil {
+			expanded[i] = arg[:2] + "=" + arg[2:]
+		} else if takesValue(cmd.Flags, arg) {
+			i++
+		}
+	}
+
+	return expanded
+}
+
+// skipOptions returns the index of the first argument from i on that isn't an option.
+func skipOptions(flags []cli.Flag, args []string, i int) int {
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "-" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		if takesValue(flags, arg) {
+			i++
+		}
+	}
+	return i
+}
+
+// takesValue reports whether the option is followed by its value as a separate argument.
+func takesValue(flags []cli.Flag, arg string) bool {
+	if strings.Contains(arg, "=") {
+		return false
+	}
+	switch lookupFlag(flags, arg).(type) {
+	case nil, *cli.BoolFlag, cli.BoolFlag:
+		return false
+	default:
+		return true
+	}
+}
+
+// lookupFlag returns the flag that the option (eg. -l or --limit=3) refers to, or nil.
+func lookupFlag(flags []cli.Flag, arg string) cli.Flag {
+	name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+	for _, flag := range flags {
+		for _, n := range strings.Split(flag.GetName(), ",") {
+			if strings.TrimSpace(n) == name {
+				return flag
+			}
+		}
+	}
 	return nil
 }
 
+func deprecated(old string, new string) {
+	fmt.Fprintf(os.Stderr, "warning: the %q command is deprecated, use %q instead.\n", old, new)
+}
+
 func formatBlocks(
 	blocks []*diskie.BlockDevice, format string, catchDuplicate bool) (
 	[]string, map[string]*diskie.BlockDevice, error) {
 
-	tmpl, err := template.New("format").Funcs(sprig.FuncMap()).Funcs(templateFuncs).Parse(format)
+	tmpl, err := parseTemplate(format)
 	if err != nil {
-		return nil, nil, fmt.Errorf("could not parse the template: %w", err)
+		return nil, nil, err
 	}
 
 	formattedSlice := make([]string, 0, len(blocks))
 	formattedMap := make(map[string]*diskie.BlockDevice, len(blocks))
 
 	for _, b := range blocks {
-		var output bytes.Buffer
-		err := tmpl.Execute(&output, b)
+		f, err := execTemplate(tmpl, b)
 		if err != nil {
-			return nil, nil, fmt.Errorf("could not execute the template: %w", err)
+			return nil, nil, err
 		}
 
-		f := strings.ReplaceAll(output.String(), "\n", "")
-
 		if catchDuplicate {
 			_, has := formattedMap[f]
 			if has {
@@ -264,20 +773,104 @@ func formatBlocks(
 	return formattedSlice, formattedMap, nil
 }
 
-func blocks(importance uint) (
-	[]*diskie.BlockDevice, map[string]*diskie.BlockDevice, error) {
-	dsk, err := diskie.Connect()
+// timeout limits each call to udisks. it's set using --timeout.
+var timeout time.Duration
+
+// callContext returns the context for a single call to udisks.
+func callContext() (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// usageTimeout limits how long the usage statistics of the mounted filesystems
+// are waited for, so that a dying drive doesn't hang the output.
+const usageTimeout = 2 * time.Second
+
+// storeUsage fills in the usage statistics of the mounted filesystems,
+// leaving out those that don't answer in time.
+func storeUsage(blockmap *diskie.BlockMap) {
+	t := usageTimeout
+	if timeout > 0 {
+		t = min(t, timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t)
+	defer cancel()
+
+	err := blockmap.StoreUsageContext(ctx)
 	if err != nil {
-		return nil, nil, fmt.Errorf("could not create diskie client: %w", err)
+		fmt.Fprintln(os.Stderr, "warning:", err)
 	}
+}
 
-	blockmap, err := dsk.BlockDevices()
+func connect() (*diskie.Conn, error) {
+	ctx, cancel := callContext()
+	defer cancel()
+	return diskie.ConnectContext(ctx)
+}
+
+func blockDevices(dsk *diskie.Conn) (*diskie.BlockMap, error) {
+	ctx, cancel := callContext()
+	defer cancel()
+	return dsk.BlockDevicesContext(ctx)
+}
+
+func parseTemplate(format string) (*template.Template, error) {
+	tmpl, err := template.New("format").Funcs(sprig.FuncMap()).Funcs(templateFuncs).Parse(format)
 	if err != nil {
-		return nil, nil, fmt.Errorf("could not get block devices: %w", err)
+		return nil, fmt.Errorf("could not parse the template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// execTemplate executes the template and removes all newlines from the result.
+func execTemplate(tmpl *template.Template, data any) (string, error) {
+	var output bytes.Buffer
+	err := tmpl.Execute(&output, data)
+	if err != nil {
+		return "", fmt.Errorf("could not execute the template: %w", err)
+	}
+	return strings.ReplaceAll(output.String(), "\n", ""), nil
+}
+
+// blocks returns the sorted and filtered block devices,
+// either from udisks or, if snapshot is given, from the snapshot file.
+func blocks(limit uint, snapshot string) (
+	[]*diskie.BlockDevice, map[string]*diskie.BlockDevice, error) {
+	var blockmap *diskie.BlockMap
+	var err error
+
+	if snapshot != "" {
+		var file string
+		file, err = expandTilde(snapshot)
+		if err != nil {
+			return nil, nil, err
+		}
+		blockmap, err = diskie.LoadSnapshot(file)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		var dsk *diskie.Conn
+		dsk, err = connect()
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not create diskie client: %w", err)
+		}
+		blockmap, err = blockDevices(dsk)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not get block devices: %w", err)
+		}
+		storeUsage(blockmap)
+	}
+
+	for _, w := range blockmap.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
 	}
 
 	blocks := blockmap.Sort()
-	blocks, err = blockmap.Filter(blocks, importance)
+	blocks, err = blockmap.Filter(blocks, limit)
 	if err != nil {
 		return nil, nil, err
 	}
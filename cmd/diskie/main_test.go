@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/koonix/diskie"
+	"github.com/koonix/diskie/diskietest"
+	"github.com/urfave/cli"
+)
+
+// the test binary runs as diskie itself if DISKIE_TEST_MAIN is set,
+// so that the tests can run the command line end to end.
+func TestMain(m *testing.M) {
+	if os.Getenv("DISKIE_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// startService serves the fixture on a private bus,
+// and returns a function that runs diskie against it.
+// the test is skipped if dbus-daemon is not installed.
+func startService(t *testing.T, fixture string) func(args ...string) (string, error) {
+	t.Helper()
+
+	_, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not in PATH")
+	}
+
+	backend, err := diskietest.Load("../../diskietest/fixtures/" + fixture + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := diskietest.StartService(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.Close() })
+
+	return func(args ...string) (string, error) {
+		t.Helper()
+		return run(t, []string{"DBUS_SYSTEM_BUS_ADDRESS=" + service.Address}, args...)
+	}
+}
+
+// run runs diskie with the given arguments and extra environment variables,
+// and returns its standard output.
+func run(t *testing.T, env []string, args ...string) (string, error) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "DISKIE_TEST_MAIN=1")
+	cmd.Env = append(cmd.Env, env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		t.Logf("diskie %s: %s", strings.Join(args, " "), stderr.String())
+	}
+
+	return stdout.String(), err
+}
+
+func TestCommandLine(t *testing.T) {
+	diskieCmd := startService(t, "luks-in-partition")
+
+	const (
+		sdb1 = "/org/freedesktop/UDisks2/block_devices/sdb1"
+		dm0  = "/org/freedesktop/UDisks2/block_devices/dm_2d0"
+	)
+
+	list := func() map[string]*diskie.BlockDevice {
+		t.Helper()
+		out, err := diskieCmd("print", "-f", "json-map")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var blocks map[string]*diskie.BlockDevice
+		err = json.Unmarshal([]byte(out), &blocks)
+		if err != nil {
+			t.Fatalf("could not parse the output of print: %v", err)
+		}
+		return blocks
+	}
+
+	blocks := list()
+	if _, has := blocks[sdb1]; !has {
+		t.Fatalf("sdb1 is missing from the output of print")
+	}
+	if _, has := blocks[dm0]; has {
+		t.Fatalf("the cleartext device of sdb1 is present before unlocking it")
+	}
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	err := os.WriteFile(passwordFile, []byte("hunter2\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = diskieCmd("attach", "-p", filepath.Join(t.TempDir(), "missing"), "/dev/sdb1")
+	if err == nil {
+		t.Fatal("attach succeeded without a password")
+	}
+
+	out, err := diskieCmd("attach", "-p", passwordFile, "/dev/sdb1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mountpoint := strings.TrimSuffix(out, "\n")
+	if !strings.HasPrefix(mountpoint, "/run/media/diskie/") {
+		t.Fatalf("attach printed %q, want a mountpoint", out)
+	}
+
+	blocks = list()
+	cleartext, has := blocks[dm0]
+	if !has {
+		t.Fatal("the cleartext device of sdb1 is missing after attach")
+	}
+	fs := cleartext.Filesystem
+	if fs == nil || fs.MountPoints == nil || len(*fs.MountPoints) != 1 || (*fs.MountPoints)[0] != mountpoint {
+		t.Fatalf("the cleartext device of sdb1 is not mounted at %s", mountpoint)
+	}
+
+	_, err = diskieCmd("detach", "/dev/sdb1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks = list()
+	if _, has := blocks[dm0]; has {
+		t.Fatal("the cleartext device of sdb1 is present after detach")
+	}
+
+	_, err = diskieCmd("detach", "/dev/sdb1")
+	if err == nil {
+		t.Fatal("detaching a locked device succeeded")
+	}
+}
+
+// the deprecated commands read snapshots just like print and select.
+func TestDeprecatedFromSnapshot(t *testing.T) {
+	tests := []struct {
+		args []string
+
+		// golden file of the output.
+		// if empty, the output is the device selected by the menu.
+		want string
+	}{
+		{
+			args: []string{"print", "-f", "tabular", "--from-snapshot", "testdata/luks-in-partition.json"},
+			want: "testdata/luks-in-partition.tabular.golden",
+		},
+		{
+			args: []string{"blockdevs", "--format", "tabular", "--from-snapshot", "testdata/luks-in-partition.json"},
+			want: "testdata/luks-in-partition.tabular.golden",
+		},
+		{
+			// the menu picks the first line
+			args: []string{"menu", "--format", "basic", "--from-snapshot", "testdata/optical.json", "head", "-n", "1"},
+		},
+		{
+			// the arguments of the menu are passed on as they are
+			args: []string{"menu", "--from-snapshot", "testdata/optical.json", "sh", "-c", `[ "$1" = -l10 ] && head -n 1`, "x", "-l10"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args[0], func(t *testing.T) {
+			// make sure that udisks isn't asked instead
+			env := []string{"DBUS_SYSTEM_BUS_ADDRESS=unix:path=/nonexistent"}
+
+			out, err := run(t, env, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.want != "" {
+				want, err := os.ReadFile(tt.want)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if out != string(want) {
+					t.Errorf("got:\n%s\nwant:\n%s", out, want)
+				}
+				return
+			}
+
+			var selected diskie.BlockDevice
+			err = json.Unmarshal([]byte(out), &selected)
+			if err != nil {
+				t.Fatalf("could not parse the output of menu: %v", err)
+			}
+			if selected.ObjectPath != "/org/freedesktop/UDisks2/block_devices/sr0" {
+				t.Errorf("menu printed %s, want sr0", selected.ObjectPath)
+			}
+		})
+	}
+}
+
+func TestExpandShortOptions(t *testing.T) {
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "notify, n"},
+			&cli.DurationFlag{Name: "timeout, t"},
+		},
+		Commands: []cli.Command{
+			{
+				Name: "select",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "format, f"},
+					&cli.UintFlag{Name: "limit, l"},
+					&cli.UintFlag{Name: "menu-max-lines, L"},
+				},
+			},
+			{
+				Name: "menu",
+				Flags: []cli.Flag{
+					&cli.UintFlag{Name: "max-lines"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{
+			args: []string{"diskie", "select", "-l3", "-L10", "dmenu"},
+			want: []string{"diskie", "select", "-l=3", "-L=10", "dmenu"},
+		},
+		{
+			args: []string{"diskie", "-n", "-t", "5s", "select", "-l3", "--", "dmenu", "-l10"},
+			want: []string{"diskie", "-n", "-t", "5s", "select", "-l=3", "--", "dmenu", "-l10"},
+		},
+		{
+			// the arguments of the menu command aren't options of diskie
+			args: []string{"diskie", "select", "dmenu", "-l10"},
+			want: []string{"diskie", "select", "dmenu", "-l10"},
+		},
+		{
+			// the value of an option isn't an option
+			args: []string{"diskie", "select", "-f", "-l3", "-l1", "dmenu"},
+			want: []string{"diskie", "select", "-f", "-l3", "-l=1", "dmenu"},
+		},
+		{
+			// menu has no -l option
+			args: []string{"diskie", "menu", "sh", "-c", "dmenu \"$@\"", "x", "-l10"},
+			want: []string{"diskie", "menu", "sh", "-c", "dmenu \"$@\"", "x", "-l10"},
+		},
+		{
+			args: []string{"diskie", "menu", "-l10"},
+			want: []string{"diskie", "menu", "-l10"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := expandShortOptions(app, tt.args)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("expandShortOptions(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
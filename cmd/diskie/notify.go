@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie"
+)
+
+// notifier is nil unless notifications are enabled using --notify.
+var notifier *diskie.Notifier
+
+func setupNotifier() error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return fmt.Errorf("could not connect to session bus: %w", err)
+	}
+
+	notifier, err = diskie.NewNotifier(context.Background(), conn, "diskie")
+	if err != nil {
+		return fmt.Errorf("could not set up notifications: %w", err)
+	}
+
+	return nil
+}
+
+// notify sends a desktop notification if notifications are enabled.
+// failing to send it is reported but otherwise ignored.
+func notify(summary string, b *diskie.BlockDevice, body string, actions ...diskie.NotificationAction) {
+	if notifier == nil {
+		return
+	}
+
+	icon := "drive-removable-media"
+	if b != nil {
+		icon = b.Icon()
+	}
+
+	_, err := notifier.Notify(diskie.Notification{
+		Summary: summary,
+		Body:    body,
+		Icon:    icon,
+		Actions: actions,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "could not send notification:", err)
+	}
+}
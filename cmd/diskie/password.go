@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/koonix/diskie"
+	"golang.org/x/term"
+)
+
+// passwordSource provides the password used to unlock encrypted devices.
+// Passwords are never accepted as command line arguments.
+//
+// Zeroing the password is best effort:
+// the terminal prompt of golang.org/x/term grows its buffer as it reads,
+// godbus copies the password into the message it sends to udisks,
+// and devices other than LUKS get the password as a string.
+// none of those copies can be cleared.
+type passwordSource interface {
+	// read returns the password without the trailing newline.
+	// the caller must zero the returned buffer after use.
+	read(prompt string) ([]byte, error)
+
+	// interactive reports whether reading again
+	// might produce a different password.
+	interactive() bool
+}
+
+// newPasswordSource picks the password source in the order of precedence
+// documented in the man page: the password file, the askpass command,
+// and finally the controlling terminal.
+func newPasswordSource(passwordFile string, askpass []string) passwordSource {
+	if passwordFile != "" {
+		return &filePasswordSource{path: passwordFile}
+	}
+	if len(askpass) > 0 {
+		return &cmdPasswordSource{cmd: askpass}
+	}
+	return &ttyPasswordSource{}
+}
+
+type filePasswordSource struct {
+	path string
+}
+
+func (s *filePasswordSource) read(prompt string) ([]byte, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the password file: %w", err)
+	}
+	defer f.Close()
+
+	password, err := readPassword(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the password file: %w", err)
+	}
+
+	return trimNewline(password), nil
+}
+
+func (s *filePasswordSource) interactive() bool {
+	return false
+}
+
+type cmdPasswordSource struct {
+	cmd []string
+}
+
+func (s *cmdPasswordSource) read(prompt string) ([]byte, error) {
+	cmd := exec.Command(s.cmd[0], s.cmd[1:]...)
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not run the askpass command: %w", err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("could not run the askpass command: %w", err)
+	}
+
+	password, readErr := readPassword(stdout)
+	if readErr != nil {
+		cmd.Process.Kill()
+	}
+
+	err = cmd.Wait()
+	if readErr != nil {
+		return nil, fmt.Errorf("could not read the output of the askpass command: %w", readErr)
+	}
+	if err != nil {
+		zero(password)
+		return nil, fmt.Errorf("the askpass command failed: %w", err)
+	}
+
+	return trimNewline(password), nil
+}
+
+func (s *cmdPasswordSource) interactive() bool {
+	return true
+}
+
+type ttyPasswordSource struct{}
+
+func (s *ttyPasswordSource) read(prompt string) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open the controlling terminal: %w", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+
+	// input is not echoed back to the terminal
+	password, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the password from the terminal: %w", err)
+	}
+
+	return password, nil
+}
+
+func (s *ttyPasswordSource) interactive() bool {
+	return true
+}
+
+// unlockWithRetry unlocks the device, asking for the password again
+// if udisks rejects it, up to the given number of attempts.
+func unlockWithRetry(dsk *diskie.Conn, b *diskie.BlockDevice, source passwordSource, attempts uint) (*diskie.BlockDevice, error) {
+	name := deviceName(b)
+
+	for attempt := uint(1); ; attempt++ {
+		password, err := source.read(fmt.Sprintf("Password for %s: ", name))
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := callContext()
+		cleartext, err := dsk.UnlockContext(ctx, b.ObjectPath, password, diskie.UnlockOptions{})
+		cancel()
+		zero(password)
+
+		if err == nil {
+			return cleartext, nil
+		}
+		if !errors.Is(err, diskie.ErrWrongPassphrase) || !source.interactive() || attempt >= attempts {
+			return nil, err
+		}
+
+		fmt.Fprintln(os.Stderr, "Wrong password, please try again.")
+	}
+}
+
+// maxPasswordSize is the size of the buffer that passwords are read into.
+// the buffer is allocated once, rather than grown,
+// so that no copies of the password are left behind.
+const maxPasswordSize = 4096
+
+// readPassword reads r to the end into a buffer of maxPasswordSize bytes.
+func readPassword(r io.Reader) ([]byte, error) {
+	// one more byte tells a password that's too long
+	// from one that fills the buffer exactly
+	buf := make([]byte, maxPasswordSize+1)
+
+	n := 0
+	for {
+		m, err := r.Read(buf[n:])
+		n += m
+		if n > maxPasswordSize {
+			zero(buf)
+			return nil, fmt.Errorf("the password is longer than %d bytes", maxPasswordSize)
+		}
+		if err == io.EOF {
+			return buf[:n], nil
+		}
+		if err != nil {
+			zero(buf)
+			return nil, err
+		}
+	}
+}
+
+func trimNewline(b []byte) []byte {
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	return bytes.TrimSuffix(b, []byte("\r"))
+}
+
+// zero overwrites the whole underlying array of the given slice,
+// including what was cut off by trimNewline.
+func zero(b []byte) {
+	clear(b[:cap(b)])
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordSources(t *testing.T) {
+	dir := t.TempDir()
+
+	n := 0
+	file := func(content string) string {
+		n++
+		path := filepath.Join(dir, fmt.Sprintf("password%d", n))
+		err := os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		source  passwordSource
+		want    string
+		wantErr bool
+	}{
+		{"file", &filePasswordSource{path: file("hunter2\n")}, "hunter2", false},
+		{"file with crlf", &filePasswordSource{path: file("hunter2\r\n")}, "hunter2", false},
+		{"file keeps inner newlines", &filePasswordSource{path: file("a\nb\n\n")}, "a\nb\n", false},
+		{"file of maximum size", &filePasswordSource{path: file(strings.Repeat("x", maxPasswordSize))}, strings.Repeat("x", maxPasswordSize), false},
+		{"file too long", &filePasswordSource{path: file(strings.Repeat("x", maxPasswordSize+1))}, "", true},
+		{"missing file", &filePasswordSource{path: filepath.Join(dir, "missing")}, "", true},
+		{"askpass", &cmdPasswordSource{cmd: []string{"printf", `hunter2\n`}}, "hunter2", false},
+		{"askpass fails", &cmdPasswordSource{cmd: []string{"sh", "-c", "echo hunter2; exit 1"}}, "", true},
+		{"askpass too long", &cmdPasswordSource{cmd: []string{"head", "-c", "100000", "/dev/zero"}}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			password, err := tt.source.read("Password: ")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("read() = %q, want an error", password)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(password) != tt.want {
+				t.Errorf("read() = %q, want %q", password, tt.want)
+			}
+
+			zero(password)
+			if !bytes.Equal(password[:cap(password)], make([]byte, cap(password))) {
+				t.Error("zero() left bytes of the password behind")
+			}
+		})
+	}
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"html/template"
+	"math"
 	"reflect"
 	"regexp"
+	"strings"
 
 	"github.com/dustin/go-humanize"
+	"github.com/koonix/diskie"
 )
 
 var condenseSpaceRegex, condenseDashRegex *regexp.Regexp
@@ -57,4 +60,22 @@ var templateFuncs = template.FuncMap{
 	"humanBytesIEC": func(v uint64) string {
 		return humanize.IBytes(v)
 	},
+
+	// usagePercent returns the rounded percentage of the used space of the filesystem,
+	// or 0 if it's not mounted.
+	"usagePercent": func(fs *diskie.Filesystem) int {
+		return int(math.Round(fs.UsagePercent()))
+	},
+
+	// usageBar draws the used space of the filesystem
+	// as a bar of the given width, e.g. "###-------".
+	// the bar is empty if the filesystem is not mounted.
+	"usageBar": func(width int, fs *diskie.Filesystem) string {
+		if width <= 0 {
+			return ""
+		}
+		used := int(math.Round(fs.UsagePercent() * float64(width) / 100))
+		used = min(used, width)
+		return strings.Repeat("#", used) + strings.Repeat("-", width-used)
+	},
 }
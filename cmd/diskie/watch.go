@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/koonix/diskie"
+)
+
+// watchEvent is the data that templates of the watch command are executed on.
+// BlockDevice is embedded so that the formats of the print command
+// work as-is on events.
+type watchEvent struct {
+	*diskie.BlockDevice
+	Type diskie.EventType
+	Time time.Time
+
+	// the filtered and sorted list of devices after the event
+	Devices []*diskie.BlockDevice
+}
+
+// devicePresent is the type of the events that the watch command prints
+// for the devices that are present when it starts.
+const devicePresent diskie.EventType = "DevicePresent"
+
+type watchEventJson struct {
+	Type   diskie.EventType
+	Time   time.Time
+	Device *diskie.BlockDevice
+}
+
+func cmdWatch(format string, limit uint) error {
+	var tmpl *template.Template
+
+	if format != "json" {
+		f, err := readFormat(format)
+		if err != nil {
+			return err
+		}
+		tmpl, err = parseTemplate(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	dsk, err := connect()
+	if err != nil {
+		return fmt.Errorf("could not create diskie client: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return watch(ctx, dsk, tmpl, limit, os.Stdout)
+}
+
+// watch prints the devices that are present and then the events to out,
+// until ctx is done.
+func watch(ctx context.Context, dsk *diskie.Conn, tmpl *template.Template, limit uint, out io.Writer) error {
+	events, err := dsk.Watch(ctx)
+	if err != nil {
+		return fmt.Errorf("could not watch block devices: %w", err)
+	}
+
+	// the devices that are present are printed first,
+	// so that the output reflects them before any device changes.
+	blockmap, err := blockDevices(dsk)
+	if err != nil {
+		return fmt.Errorf("could not get block devices: %w", err)
+	}
+
+	storeUsage(blockmap)
+
+	present, err := blockmap.Filter(blockmap.Sort(), limit)
+	if err != nil {
+		return err
+	}
+
+	// templates are executed on an empty device if none is present,
+	// so that those that only use .Devices still print their initial value.
+	// the others, such as the builtin formats, print an empty line.
+	if len(present) == 0 && tmpl != nil {
+		line, err := execTemplate(tmpl, watchEvent{
+			BlockDevice: &diskie.BlockDevice{},
+			Type:        devicePresent,
+			Time:        time.Now(),
+		})
+		if err != nil {
+			line = ""
+		}
+		fmt.Fprintln(out, line)
+	}
+
+	for _, b := range present {
+		err := printEvent(out, tmpl, diskie.Event{Type: devicePresent, Device: b, BlockMap: blockmap}, limit)
+		if err != nil {
+			return err
+		}
+	}
+
+	for event := range events {
+		filtered, err := event.BlockMap.Filter([]*diskie.BlockDevice{event.Device}, limit)
+		if err != nil {
+			return err
+		}
+		if len(filtered) == 0 {
+			continue
+		}
+
+		storeUsage(event.BlockMap)
+
+		err = printEvent(out, tmpl, event, limit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printEvent prints the event as a line of JSON if tmpl is nil,
+// or executes tmpl on it otherwise.
+func printEvent(out io.Writer, tmpl *template.Template, event diskie.Event, limit uint) error {
+	now := time.Now()
+
+	if tmpl == nil {
+		line, err := json.Marshal(watchEventJson{
+			Type:   event.Type,
+			Time:   now,
+			Device: event.Device,
+		})
+		if err != nil {
+			return fmt.Errorf("could not marshal event into json: %w", err)
+		}
+		fmt.Fprintln(out, string(line))
+		return nil
+	}
+
+	devices, err := event.BlockMap.Filter(event.BlockMap.Sort(), limit)
+	if err != nil {
+		return err
+	}
+
+	line, err := execTemplate(tmpl, watchEvent{
+		BlockDevice: event.Device,
+		Type:        event.Type,
+		Time:        now,
+		Devices:     devices,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, line)
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/koonix/diskie"
+	"github.com/koonix/diskie/diskietest"
+)
+
+// startWatch runs watch against the backend and returns its lines of output.
+func startWatch(t *testing.T, backend *diskietest.Backend, format string) <-chan string {
+	t.Helper()
+
+	var tmpl *template.Template
+	if format != "json" {
+		var err error
+		tmpl, err = parseTemplate(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, w := io.Pipe()
+
+	done := make(chan error)
+	go func() {
+		err := watch(ctx, diskie.NewConn(backend), tmpl, 0, w)
+		w.Close()
+		done <- err
+	}()
+	t.Cleanup(func() {
+		cancel()
+		r.Close()
+		err := <-done
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	return lines
+}
+
+func nextLine(t *testing.T, lines <-chan string) string {
+	t.Helper()
+	select {
+	case line, ok := <-lines:
+		if !ok {
+			t.Fatal("watch stopped printing")
+		}
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a line")
+		return ""
+	}
+}
+
+func TestWatchPrintsPresentDevices(t *testing.T) {
+	const sdb2 = "/org/freedesktop/UDisks2/block_devices/sdb2"
+
+	backend, err := diskietest.Load("../../diskietest/fixtures/luks-in-partition.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bm, err := diskie.NewConn(backend).BlockDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	present, err := bm.Filter(bm.Sort(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := startWatch(t, backend, "json")
+
+	for _, b := range present {
+		var event watchEventJson
+		err := json.Unmarshal([]byte(nextLine(t, lines)), &event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != devicePresent || event.Device.ObjectPath != b.ObjectPath {
+			t.Errorf("got %s of %s, want %s of %s", event.Type, event.Device.ObjectPath, devicePresent, b.ObjectPath)
+		}
+	}
+
+	_, err = diskie.NewConn(backend).Mount(sdb2, diskie.MountOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var event watchEventJson
+	err = json.Unmarshal([]byte(nextLine(t, lines)), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != diskie.Mounted || event.Device.ObjectPath != sdb2 {
+		t.Errorf("got %s of %s, want %s of %s", event.Type, event.Device.ObjectPath, diskie.Mounted, sdb2)
+	}
+}
+
+// a status bar shows the count of devices from the start, even if it's zero.
+func TestWatchPrintsInitialCount(t *testing.T) {
+	backend := diskietest.New(diskie.Objects{}, nil)
+
+	lines := startWatch(t, backend, "{{ .Type }} {{ len .Devices }}")
+
+	if line := nextLine(t, lines); line != "DevicePresent 0" {
+		t.Errorf("got %q, want the count of devices", line)
+	}
+}
@@ -0,0 +1,212 @@
+package diskie
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestDecodeWrongTypes(t *testing.T) {
+	const path = "/org/freedesktop/UDisks2/block_devices/sda1"
+
+	tests := []struct {
+		name     string
+		props    map[string]dbus.Variant
+		property string
+		decode   func(map[string]dbus.Variant) (unset bool, errs []error)
+	}{
+		{
+			name: "bytestring as string",
+			props: map[string]dbus.Variant{
+				"Device": dbus.MakeVariant("/dev/sda1"),
+				"Size":   dbus.MakeVariant(uint64(1024)),
+			},
+			property: "Device",
+			decode: func(props map[string]dbus.Variant) (bool, []error) {
+				b, errs := decodeBlock(path, props)
+				if b.Size == nil || *b.Size != 1024 {
+					t.Errorf("Size = %v, want 1024", b.Size)
+				}
+				return b.Device == nil, errs
+			},
+		},
+		{
+			name: "uint64 as int32",
+			props: map[string]dbus.Variant{
+				"Size": dbus.MakeVariant(int32(1024)),
+			},
+			property: "Size",
+			decode: func(props map[string]dbus.Variant) (bool, []error) {
+				b, errs := decodeBlock(path, props)
+				return b.Size == nil, errs
+			},
+		},
+		{
+			name: "object path as string",
+			props: map[string]dbus.Variant{
+				"CryptoBackingDevice": dbus.MakeVariant("/org/freedesktop/UDisks2/block_devices/sda"),
+			},
+			property: "CryptoBackingDevice",
+			decode: func(props map[string]dbus.Variant) (bool, []error) {
+				b, errs := decodeBlock(path, props)
+				return b.CryptoBackingDevice == nil, errs
+			},
+		},
+		{
+			name: "boolean as string",
+			props: map[string]dbus.Variant{
+				"MediaAvailable": dbus.MakeVariant("true"),
+				"Model":          dbus.MakeVariant("Ultra"),
+			},
+			property: "MediaAvailable",
+			decode: func(props map[string]dbus.Variant) (bool, []error) {
+				d, errs := decodeDrive("/org/freedesktop/UDisks2/drives/Ultra", props)
+				if d.Model == nil || *d.Model != "Ultra" {
+					t.Errorf("Model = %v, want Ultra", d.Model)
+				}
+				return d.MediaAvailable == nil, errs
+			},
+		},
+		{
+			name: "string as uint64",
+			props: map[string]dbus.Variant{
+				"SortKey": dbus.MakeVariant(uint64(1)),
+			},
+			property: "SortKey",
+			decode: func(props map[string]dbus.Variant) (bool, []error) {
+				d, errs := decodeDrive("/org/freedesktop/UDisks2/drives/Ultra", props)
+				return d.SortKey == nil, errs
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unset, errs := tt.decode(tt.props)
+			if !unset {
+				t.Errorf("%s was set", tt.property)
+			}
+			if len(errs) != 1 {
+				t.Fatalf("got %d errors, want 1: %v", len(errs), errs)
+			}
+			var decodeErr *DecodeError
+			if !errors.As(errs[0], &decodeErr) {
+				t.Fatalf("got %T, want *DecodeError", errs[0])
+			}
+			if decodeErr.Property != tt.property {
+				t.Errorf("DecodeError.Property = %q, want %q", decodeErr.Property, tt.property)
+			}
+		})
+	}
+}
+
+func TestNewBlockMapDanglingLinks(t *testing.T) {
+	const (
+		sda1    = "/org/freedesktop/UDisks2/block_devices/sda1"
+		dm0     = "/org/freedesktop/UDisks2/block_devices/dm_2d0"
+		missing = "/org/freedesktop/UDisks2/block_devices/missing"
+	)
+
+	block := func(backing string) map[string]dbus.Variant {
+		return map[string]dbus.Variant{
+			"Device":              dbus.MakeVariant([]byte("/dev/x\x00")),
+			"CryptoBackingDevice": dbus.MakeVariant(dbus.ObjectPath(backing)),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		objects     Objects
+		property    string
+		wantRoot    map[string]string
+		wantClosing map[string]string
+	}{
+		{
+			name: "CryptoBackingDevice",
+			objects: Objects{
+				dm0: {"org.freedesktop.UDisks2.Block": block(missing)},
+			},
+			property:    "CryptoBackingDevice",
+			wantRoot:    map[string]string{dm0: dm0},
+			wantClosing: map[string]string{dm0: dm0},
+		},
+		{
+			name: "CleartextDevice",
+			objects: Objects{
+				sda1: {
+					"org.freedesktop.UDisks2.Block": block("/"),
+					"org.freedesktop.UDisks2.Encrypted": {
+						"CleartextDevice": dbus.MakeVariant(dbus.ObjectPath(missing)),
+					},
+				},
+			},
+			property:    "CleartextDevice",
+			wantRoot:    map[string]string{sda1: sda1},
+			wantClosing: map[string]string{sda1: sda1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bm := newBlockMap(tt.objects)
+
+			if len(bm.Warnings) != 1 {
+				t.Fatalf("got %d warnings, want 1: %v", len(bm.Warnings), bm.Warnings)
+			}
+			var linkErr *UnresolvedLinkError
+			if !errors.As(bm.Warnings[0], &linkErr) {
+				t.Fatalf("got %T, want *UnresolvedLinkError", bm.Warnings[0])
+			}
+			if linkErr.Property != tt.property || linkErr.Target != missing {
+				t.Errorf("got %+v, want %s linking to %s", linkErr, tt.property, missing)
+			}
+
+			for path, want := range tt.wantRoot {
+				if got := bm.BlockMap[path].CryptoRootDevice; got != want {
+					t.Errorf("CryptoRootDevice of %s = %s, want %s", path, got, want)
+				}
+			}
+			for path, want := range tt.wantClosing {
+				if got := bm.BlockMap[path].CryptoClosingDevice; got != want {
+					t.Errorf("CryptoClosingDevice of %s = %s, want %s", path, got, want)
+				}
+			}
+
+			if len(bm.Sort()) != len(bm.BlockMap) {
+				t.Errorf("Sort lost devices")
+			}
+		})
+	}
+}
+
+// Sort must not rely on the root device of every device being in the BlockMap,
+// for example after the root device was taken out of it.
+func TestSortMissingRootDevice(t *testing.T) {
+	size := func(n uint64) *uint64 { return &n }
+
+	bm := &BlockMap{
+		BlockMap: map[string]*BlockDevice{
+			"small": {
+				ObjectPath:       "small",
+				PreferredSize:    size(1),
+				CryptoRootDevice: "gone",
+			},
+			"big": {
+				ObjectPath:       "big",
+				PreferredSize:    size(2),
+				CryptoRootDevice: "big",
+			},
+		},
+	}
+
+	blocks := bm.Sort()
+
+	if len(blocks) != 2 || blocks[0].ObjectPath != "big" || blocks[1].ObjectPath != "small" {
+		var got []string
+		for _, b := range blocks {
+			got = append(got, b.ObjectPath)
+		}
+		t.Errorf("Sort() = %v, want [big small]", got)
+	}
+}
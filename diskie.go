@@ -2,14 +2,14 @@ package diskie
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"strings"
 
 	"github.com/godbus/dbus/v5"
 )
 
 type Conn struct {
-	conn *dbus.Conn
+	backend Backend
 }
 
 type BlockDevice struct {
@@ -37,8 +37,10 @@ type BlockDevice struct {
 	HintSymbolicIconName  *string
 	UserspaceMountOptions *[]string
 	Partition             *Partition
+	PartitionTable        *PartitionTable
 	Filesystem            *Filesystem
 	Encrypted             *Encrypted
+	Loop                  *Loop
 
 	// convenient diskie-specific attributes
 
@@ -54,6 +56,7 @@ type BlockDevice struct {
 }
 
 type Drive struct {
+	ObjectPath            string
 	Vendor                *string
 	Model                 *string
 	Revision              *string
@@ -94,11 +97,40 @@ type Partition struct {
 	UUID        *string
 	IsContainer *bool
 	IsContained *bool
+
+	// object path of the block device that contains the partition table
+	Table *string
+}
+
+type PartitionTable struct {
+	Type *string
+
+	// object paths of the partitions
+	Partitions *[]string
 }
 
 type Filesystem struct {
 	MountPoints *[]string
 	Size        *uint64
+
+	// usage statistics of mounted filesystems, in bytes,
+	// taken with statfs(2) on the first mountpoint.
+	// they're only filled in by BlockMap.StoreUsage,
+	// and are nil if the filesystem is not mounted or can't be inspected.
+
+	Used      *uint64
+	Free      *uint64
+	Available *uint64 // free space that's available to unprivileged users
+
+	InodesTotal *uint64
+	InodesFree  *uint64
+}
+
+type Loop struct {
+	// path of the file that the loop device is backed by
+	BackingFile *string
+	Autoclear   *bool
+	SetupByUID  *uint32
 }
 
 type Encrypted struct {
@@ -108,147 +140,136 @@ type Encrypted struct {
 }
 
 func Connect() (*Conn, error) {
-	conn, err := dbus.ConnectSystemBus()
-	if err != nil {
-		return nil, fmt.Errorf("could not connect to system bus: %w", err)
-	}
-	return &Conn{
-		conn: conn,
-	}, nil
+	return ConnectContext(context.Background())
 }
 
-func (c *Conn) BlockDevices() (*BlockMap, error) {
-	obj := c.conn.Object(
-		"org.freedesktop.UDisks2",
-		"/org/freedesktop/UDisks2/Manager",
-	)
+// ConnectContext connects to the system bus,
+// giving up when ctx is done.
+// ctx only applies to connecting, not to the lifetime of the connection.
+func ConnectContext(ctx context.Context) (*Conn, error) {
+	type result struct {
+		conn *dbus.Conn
+		err  error
+	}
 
-	method := "org.freedesktop.UDisks2.Manager.GetBlockDevices"
+	ch := make(chan result, 1)
+
+	go func() {
+		conn, err := dbus.ConnectSystemBus()
+		ch <- result{conn, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		// close the connection if it's established after giving up
+		go func() {
+			r := <-ch
+			if r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("could not connect to system bus: %w", contextError(ctx.Err()))
+	case r := <-ch:
+		if r.err != nil {
+			return nil, fmt.Errorf("could not connect to system bus: %w", r.err)
+		}
+		return NewConn(&busBackend{r.conn}), nil
+	}
+}
 
-	var paths []dbus.ObjectPath
+func (c *Conn) BlockDevices() (*BlockMap, error) {
+	return c.BlockDevicesContext(context.Background())
+}
 
-	err := obj.Call(method, 0, map[string]interface{}{}).Store(&paths)
+func (c *Conn) BlockDevicesContext(ctx context.Context) (*BlockMap, error) {
+	objects, err := c.backend.ManagedObjects(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("method %s failed: %w", method, err)
+		return nil, callError("org.freedesktop.DBus.ObjectManager.GetManagedObjects", err)
 	}
 
-	blockmap := make(map[string]*BlockDevice, len(paths))
+	return newBlockMap(objects), nil
+}
 
-	for _, path := range paths {
+// newBlockMap builds the block devices out of
+// the reply of org.freedesktop.DBus.ObjectManager.GetManagedObjects.
+func newBlockMap(objects Objects) *BlockMap {
+	blockmap := make(map[string]*BlockDevice)
+	drives := make(map[dbus.ObjectPath]*Drive)
 
-		obj := c.conn.Object("org.freedesktop.UDisks2", path)
-		property := "org.freedesktop.UDisks2.Block"
+	var warnings []error
 
-		var store map[string]dbus.Variant
+	for path, interfaces := range objects {
 
-		err := obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, property).Store(&store)
-		if err != nil {
-			return nil, fmt.Errorf("could not get property %s: %w", property, err)
+		props, has := interfaces["org.freedesktop.UDisks2.Block"]
+		if !has {
+			continue
 		}
 
-		block := BlockDevice{
-			ObjectPath: string(path),
-		}
+		block, errs := decodeBlock(path, props)
+		warnings = append(warnings, errs...)
 
-		for k, v := range store {
-			switch k {
-			case "Device":
-				val := toString(v.Value().([]byte))
-				block.Device = &val
-			case "PreferredDevice":
-				val := toString(v.Value().([]byte))
-				block.PreferredDevice = &val
-			case "Symlinks":
-				val := []string{}
-				for _, s := range v.Value().([][]byte) {
-					val = append(val, toString(s))
+		// BlockDevice.Drive
+		v, has := props["Drive"]
+		drivePath, ok := v.Value().(dbus.ObjectPath)
+		if has && !ok {
+			warnings = append(warnings, &DecodeError{
+				ObjectPath: string(path),
+				Interface:  "org.freedesktop.UDisks2.Block",
+				Property:   "Drive",
+				Err:        typeError[dbus.ObjectPath](v),
+			})
+		}
+		if ok && drivePath != "/" {
+			drive, has := drives[drivePath]
+			if !has {
+				props, has := objects[drivePath]["org.freedesktop.UDisks2.Drive"]
+				if has {
+					drive, errs = decodeDrive(drivePath, props)
+					warnings = append(warnings, errs...)
 				}
-				block.Symlinks = &val
-			case "DeviceNumber":
-				val := v.Value().(uint64)
-				block.DeviceNumber = &val
-			case "Id":
-				val := v.Value().(string)
-				block.Id = &val
-			case "Size":
-				val := v.Value().(uint64)
-				block.Size = &val
-			case "ReadOnly":
-				val := v.Value().(bool)
-				block.ReadOnly = &val
-			case "IdUsage":
-				val := v.Value().(string)
-				block.IdUsage = &val
-			case "IdType":
-				val := v.Value().(string)
-				block.IdType = &val
-			case "IdVersion":
-				val := v.Value().(string)
-				block.IdVersion = &val
-			case "IdLabel":
-				val := v.Value().(string)
-				block.IdLabel = &val
-			case "IdUUID":
-				val := v.Value().(string)
-				block.IdUUID = &val
-			case "CryptoBackingDevice":
-				val := string(v.Value().(dbus.ObjectPath))
-				block.CryptoBackingDevice = &val
-			case "HintPartitionable":
-				val := v.Value().(bool)
-				block.HintPartitionable = &val
-			case "HintSystem":
-				val := v.Value().(bool)
-				block.HintSystem = &val
-			case "HintIgnore":
-				val := v.Value().(bool)
-				block.HintIgnore = &val
-			case "HintAuto":
-				val := v.Value().(bool)
-				block.HintAuto = &val
-			case "HintName":
-				val := v.Value().(string)
-				block.HintName = &val
-			case "HintIconName":
-				val := v.Value().(string)
-				block.HintIconName = &val
-			case "HintSymbolicIconName":
-				val := v.Value().(string)
-				block.HintSymbolicIconName = &val
-			case "UserspaceMountOptions":
-				val := v.Value().([]string)
-				block.UserspaceMountOptions = &val
+				drives[drivePath] = drive
 			}
+			block.Drive = drive
 		}
 
-		// BlockDevice.Drive
-		var drivePath dbus.ObjectPath
-		property = "org.freedesktop.UDisks2.Block.Drive"
-		err = obj.StoreProperty(property, &drivePath)
-		if err != nil {
-			return nil, fmt.Errorf("could not get property %s: %w", property, err)
-		}
-		drive, err := c.getDrive(drivePath)
-		if err != nil {
-			return nil, fmt.Errorf("could not get BlockDevice.Drive: %w", err)
+		// BlockDevice.Partition
+		props, has = interfaces["org.freedesktop.UDisks2.Partition"]
+		if has {
+			block.Partition, errs = decodePartition(path, props)
+			warnings = append(warnings, errs...)
 		}
-		block.Drive = drive
 
-		// BlockDevice.Partition
-		partition, err := getPartition(obj)
-		if err != nil {
-			return nil, fmt.Errorf("could not get BlockDevice.Partition: %w", err)
+		// BlockDevice.PartitionTable
+		props, has = interfaces["org.freedesktop.UDisks2.PartitionTable"]
+		if has {
+			block.PartitionTable, errs = decodePartitionTable(path, props)
+			warnings = append(warnings, errs...)
 		}
-		block.Partition = partition
 
 		// BlockDevice.Filesystem
-		fs, err := getFilesystem(obj)
-		if err != nil {
-			return nil, fmt.Errorf("could not get BlockDevice.Filesystem: %w", err)
+		props, has = interfaces["org.freedesktop.UDisks2.Filesystem"]
+		if has {
+			block.Filesystem, errs = decodeFilesystem(path, props)
+			warnings = append(warnings, errs...)
+		}
+
+		// BlockDevice.Encrypted
+		props, has = interfaces["org.freedesktop.UDisks2.Encrypted"]
+		if has {
+			block.Encrypted, errs = decodeEncrypted(path, props)
+			warnings = append(warnings, errs...)
+		}
+
+		// BlockDevice.Loop
+		props, has = interfaces["org.freedesktop.UDisks2.Loop"]
+		if has {
+			block.Loop, errs = decodeLoop(path, props)
+			warnings = append(warnings, errs...)
 		}
-		block.Filesystem = fs
 
 		// BlockDevice.PreferredSize
+		fs := block.Filesystem
+		partition := block.Partition
 		if fs != nil && fs.Size != nil && *fs.Size != 0 {
 			block.PreferredSize = fs.Size
 		} else if partition != nil && partition.Size != nil && *partition.Size != 0 {
@@ -257,68 +278,61 @@ func (c *Conn) BlockDevices() (*BlockMap, error) {
 			block.PreferredSize = block.Size
 		}
 
-		// BlockDevice.Encrypted
-		enc, err := getEncrypted(obj)
-		if err != nil {
-			return nil, fmt.Errorf("could not get BlockDevic.Encrypted: %w", err)
-		}
-		block.Encrypted = enc
-
-		blockmap[block.ObjectPath] = &block
-	}
-
-	// BlockDevice.CryptoRootDrive
-	var getRootDrive func(*BlockDevice) *Drive
-	getRootDrive = func(b *BlockDevice) *Drive {
-		if b.Drive != nil {
-			return b.Drive
-		}
-		c := b.CryptoBackingDevice
-		if c == nil || *c == "/" {
-			return nil
-		}
-		b, has := blockmap[*c]
-		if has {
-			return getRootDrive(b)
-		}
-		panic(fmt.Errorf("CryptoBackingDevice not found in the list of devices: %s", *c))
-	}
-	for _, b := range blockmap {
-		b.CryptoRootDrive = getRootDrive(b)
+		blockmap[block.ObjectPath] = block
 	}
 
 	// BlockDevice.CryptoRootDevice
-	var getRootDevice func(*BlockDevice) string
-	getRootDevice = func(b *BlockDevice) string {
-		c := b.CryptoBackingDevice
-		if c == nil || *c == "/" {
-			return b.ObjectPath
-		}
-		b, has := blockmap[*c]
-		if has {
-			return getRootDevice(b)
-		}
-		panic(fmt.Errorf("CryptoBackingDevice not found in the list of devices: %s", *c))
-	}
+	// devices whose CryptoBackingDevice can't be found
+	// are treated as the root of their chain.
+	// BlockDevice.CryptoRootDrive is the first drive found along the way.
 	for _, b := range blockmap {
-		b.CryptoRootDevice = getRootDevice(b)
+		root := b
+		drive := b.Drive
+		for depth := 0; depth < len(blockmap); depth++ {
+			c := root.CryptoBackingDevice
+			if c == nil || *c == "/" {
+				break
+			}
+			backing, has := blockmap[*c]
+			if !has {
+				warnings = append(warnings, &UnresolvedLinkError{
+					ObjectPath: root.ObjectPath,
+					Property:   "CryptoBackingDevice",
+					Target:     *c,
+				})
+				break
+			}
+			root = backing
+			if drive == nil {
+				drive = root.Drive
+			}
+		}
+		b.CryptoRootDevice = root.ObjectPath
+		b.CryptoRootDrive = drive
 	}
 
 	// BlockDevice.CryptoClosingDevice
-	var getClosingDevice func(*BlockDevice) string
-	getClosingDevice = func(b *BlockDevice) string {
-		e := b.Encrypted
-		if e == nil || e.CleartextDevice == nil || *e.CleartextDevice == "/" {
-			return b.ObjectPath
-		}
-		b, has := blockmap[*e.CleartextDevice]
-		if has {
-			return getClosingDevice(b)
-		}
-		panic(fmt.Errorf("CleartextDevice not found in the list of devices: %s", *e.CleartextDevice))
-	}
+	// devices whose CleartextDevice can't be found
+	// are treated as the closing device of their chain.
 	for _, b := range blockmap {
-		b.CryptoClosingDevice = getClosingDevice(b)
+		closing := b
+		for depth := 0; depth < len(blockmap); depth++ {
+			e := closing.Encrypted
+			if e == nil || e.CleartextDevice == nil || *e.CleartextDevice == "/" {
+				break
+			}
+			cleartext, has := blockmap[*e.CleartextDevice]
+			if !has {
+				warnings = append(warnings, &UnresolvedLinkError{
+					ObjectPath: closing.ObjectPath,
+					Property:   "CleartextDevice",
+					Target:     *e.CleartextDevice,
+				})
+				break
+			}
+			closing = cleartext
+		}
+		b.CryptoClosingDevice = closing.ObjectPath
 	}
 
 	for _, b := range blockmap {
@@ -362,230 +376,364 @@ func (c *Conn) BlockDevices() (*BlockMap, error) {
 
 	return &BlockMap{
 		BlockMap: blockmap,
-	}, nil
+		Warnings: warnings,
+	}
 }
 
-func (c *Conn) getDrive(path dbus.ObjectPath) (*Drive, error) {
-	if path == "/" {
-		return nil, nil
+func decodeBlock(path dbus.ObjectPath, props map[string]dbus.Variant) (*BlockDevice, []error) {
+	block := BlockDevice{
+		ObjectPath: string(path),
 	}
 
-	obj := c.conn.Object("org.freedesktop.UDisks2", path)
-	property := "org.freedesktop.UDisks2.Drive"
+	var errs []error
+
+	for k, v := range props {
+		var err error
+		switch k {
+		case "Device":
+			err = storeBytestring(v, &block.Device)
+		case "PreferredDevice":
+			err = storeBytestring(v, &block.PreferredDevice)
+		case "Symlinks":
+			err = storeBytestrings(v, &block.Symlinks)
+		case "DeviceNumber":
+			err = store(v, &block.DeviceNumber)
+		case "Id":
+			err = store(v, &block.Id)
+		case "Size":
+			err = store(v, &block.Size)
+		case "ReadOnly":
+			err = store(v, &block.ReadOnly)
+		case "IdUsage":
+			err = store(v, &block.IdUsage)
+		case "IdType":
+			err = store(v, &block.IdType)
+		case "IdVersion":
+			err = store(v, &block.IdVersion)
+		case "IdLabel":
+			err = store(v, &block.IdLabel)
+		case "IdUUID":
+			err = store(v, &block.IdUUID)
+		case "CryptoBackingDevice":
+			err = storeObjectPath(v, &block.CryptoBackingDevice)
+		case "HintPartitionable":
+			err = store(v, &block.HintPartitionable)
+		case "HintSystem":
+			err = store(v, &block.HintSystem)
+		case "HintIgnore":
+			err = store(v, &block.HintIgnore)
+		case "HintAuto":
+			err = store(v, &block.HintAuto)
+		case "HintName":
+			err = store(v, &block.HintName)
+		case "HintIconName":
+			err = store(v, &block.HintIconName)
+		case "HintSymbolicIconName":
+			err = store(v, &block.HintSymbolicIconName)
+		case "UserspaceMountOptions":
+			err = store(v, &block.UserspaceMountOptions)
+		}
+		if err != nil {
+			errs = append(errs, &DecodeError{
+				ObjectPath: string(path),
+				Interface:  "org.freedesktop.UDisks2.Block",
+				Property:   k,
+				Err:        err,
+			})
+		}
+	}
 
-	var store map[string]dbus.Variant
+	return &block, errs
+}
 
-	err := obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, property).Store(&store)
-	if err != nil {
-		return nil, fmt.Errorf("could not get property %s: %w", property, err)
+func decodeDrive(path dbus.ObjectPath, props map[string]dbus.Variant) (*Drive, []error) {
+	drive := Drive{
+		ObjectPath: string(path),
 	}
 
-	var drive Drive
+	var errs []error
 
-	for k, v := range store {
+	for k, v := range props {
+		var err error
 		switch k {
 		case "Vendor":
-			val := v.Value().(string)
-			drive.Vendor = &val
+			err = store(v, &drive.Vendor)
 		case "Model":
-			val := v.Value().(string)
-			drive.Model = &val
+			err = store(v, &drive.Model)
 		case "Revision":
-			val := v.Value().(string)
-			drive.Revision = &val
+			err = store(v, &drive.Revision)
 		case "Serial":
-			val := v.Value().(string)
-			drive.Serial = &val
+			err = store(v, &drive.Serial)
 		case "WWN":
-			val := v.Value().(string)
-			drive.WWN = &val
+			err = store(v, &drive.WWN)
 		case "Id":
-			val := v.Value().(string)
-			drive.Id = &val
+			err = store(v, &drive.Id)
 		case "Media":
-			val := v.Value().(string)
-			drive.Media = &val
+			err = store(v, &drive.Media)
 		case "MediaCompatibility":
-			val := v.Value().([]string)
-			drive.MediaCompatibility = &val
+			err = store(v, &drive.MediaCompatibility)
 		case "MediaRemovable":
-			val := v.Value().(bool)
-			drive.MediaRemovable = &val
+			err = store(v, &drive.MediaRemovable)
 		case "MediaAvailable":
-			val := v.Value().(bool)
-			drive.MediaAvailable = &val
+			err = store(v, &drive.MediaAvailable)
 		case "MediaChangeDetected":
-			val := v.Value().(bool)
-			drive.MediaChangeDetected = &val
+			err = store(v, &drive.MediaChangeDetected)
 		case "Size":
-			val := v.Value().(uint64)
-			drive.Size = &val
+			err = store(v, &drive.Size)
 		case "TimeDetected":
-			val := v.Value().(uint64)
-			drive.TimeDetected = &val
+			err = store(v, &drive.TimeDetected)
 		case "TimeMediaDetected":
-			val := v.Value().(uint64)
-			drive.TimeMediaDetected = &val
+			err = store(v, &drive.TimeMediaDetected)
 		case "Optical":
-			val := v.Value().(bool)
-			drive.Optical = &val
+			err = store(v, &drive.Optical)
 		case "OpticalBlank":
-			val := v.Value().(bool)
-			drive.OpticalBlank = &val
+			err = store(v, &drive.OpticalBlank)
 		case "OpticalNumTracks":
-			val := v.Value().(uint32)
-			drive.OpticalNumTracks = &val
+			err = store(v, &drive.OpticalNumTracks)
 		case "OpticalNumAudioTracks":
-			val := v.Value().(uint32)
-			drive.OpticalNumAudioTracks = &val
+			err = store(v, &drive.OpticalNumAudioTracks)
 		case "OpticalNumDataTracks":
-			val := v.Value().(uint32)
-			drive.OpticalNumDataTracks = &val
+			err = store(v, &drive.OpticalNumDataTracks)
 		case "OpticalNumSessions":
-			val := v.Value().(uint32)
-			drive.OpticalNumSessions = &val
+			err = store(v, &drive.OpticalNumSessions)
 		case "RotationRate":
-			val := v.Value().(int32)
-			drive.RotationRate = &val
+			err = store(v, &drive.RotationRate)
 		case "ConnectionBus":
-			val := v.Value().(string)
-			drive.ConnectionBus = &val
+			err = store(v, &drive.ConnectionBus)
 		case "Seat":
-			val := v.Value().(string)
-			drive.Seat = &val
+			err = store(v, &drive.Seat)
 		case "Removable":
-			val := v.Value().(bool)
-			drive.Removable = &val
+			err = store(v, &drive.Removable)
 		case "Ejectable":
-			val := v.Value().(bool)
-			drive.Ejectable = &val
+			err = store(v, &drive.Ejectable)
 		case "SortKey":
-			val := v.Value().(string)
-			drive.SortKey = &val
+			err = store(v, &drive.SortKey)
 		case "CanPowerOff":
-			val := v.Value().(bool)
-			drive.CanPowerOff = &val
+			err = store(v, &drive.CanPowerOff)
 		case "SiblingId":
-			val := v.Value().(string)
-			drive.SiblingId = &val
+			err = store(v, &drive.SiblingId)
+		}
+		if err != nil {
+			errs = append(errs, &DecodeError{
+				ObjectPath: string(path),
+				Interface:  "org.freedesktop.UDisks2.Drive",
+				Property:   k,
+				Err:        err,
+			})
 		}
 	}
 
-	return &drive, nil
+	return &drive, errs
 }
 
-func getEncrypted(obj dbus.BusObject) (*Encrypted, error) {
-	property := "org.freedesktop.UDisks2.Encrypted"
-
-	var store map[string]dbus.Variant
-
-	err := obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, property).Store(&store)
-
-	if err != nil && strings.Contains(err.Error(), "No such interface") {
-		return nil, nil
-	} else if err != nil {
-		return nil, fmt.Errorf("could not get property %s: %w", property, err)
-	}
-
+func decodeEncrypted(path dbus.ObjectPath, props map[string]dbus.Variant) (*Encrypted, []error) {
 	var enc Encrypted
 
-	for k, v := range store {
+	var errs []error
+
+	for k, v := range props {
+		var err error
 		switch k {
 		case "HintEncryptionType":
-			val := v.Value().(string)
-			enc.HintEncryptionType = &val
+			err = store(v, &enc.HintEncryptionType)
 		case "MetadataSize":
-			val := v.Value().(uint64)
-			enc.MetadataSize = &val
+			err = store(v, &enc.MetadataSize)
 		case "CleartextDevice":
-			val := string(v.Value().(dbus.ObjectPath))
-			enc.CleartextDevice = &val
+			err = storeObjectPath(v, &enc.CleartextDevice)
+		}
+		if err != nil {
+			errs = append(errs, &DecodeError{
+				ObjectPath: string(path),
+				Interface:  "org.freedesktop.UDisks2.Encrypted",
+				Property:   k,
+				Err:        err,
+			})
 		}
 	}
 
-	return &enc, nil
+	return &enc, errs
 }
 
-func getFilesystem(obj dbus.BusObject) (*Filesystem, error) {
-	property := "org.freedesktop.UDisks2.Filesystem"
-
-	var store map[string]dbus.Variant
+func decodeLoop(path dbus.ObjectPath, props map[string]dbus.Variant) (*Loop, []error) {
+	var loop Loop
 
-	err := obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, property).Store(&store)
+	var errs []error
 
-	if err != nil && strings.Contains(err.Error(), "No such interface") {
-		return nil, nil
-	} else if err != nil {
-		return nil, fmt.Errorf("could not get property %s: %w", property, err)
+	for k, v := range props {
+		var err error
+		switch k {
+		case "BackingFile":
+			err = storeBytestring(v, &loop.BackingFile)
+		case "Autoclear":
+			err = store(v, &loop.Autoclear)
+		case "SetupByUID":
+			err = store(v, &loop.SetupByUID)
+		}
+		if err != nil {
+			errs = append(errs, &DecodeError{
+				ObjectPath: string(path),
+				Interface:  "org.freedesktop.UDisks2.Loop",
+				Property:   k,
+				Err:        err,
+			})
+		}
 	}
 
+	return &loop, errs
+}
+
+func decodeFilesystem(path dbus.ObjectPath, props map[string]dbus.Variant) (*Filesystem, []error) {
 	var fs Filesystem
 
-	for k, v := range store {
+	var errs []error
+
+	for k, v := range props {
+		var err error
 		switch k {
 		case "MountPoints":
-			val := []string{}
-			for _, s := range v.Value().([][]byte) {
-				val = append(val, toString(s))
-			}
-			fs.MountPoints = &val
+			err = storeBytestrings(v, &fs.MountPoints)
 		case "Size":
-			val := v.Value().(uint64)
-			fs.Size = &val
+			err = store(v, &fs.Size)
+		}
+		if err != nil {
+			errs = append(errs, &DecodeError{
+				ObjectPath: string(path),
+				Interface:  "org.freedesktop.UDisks2.Filesystem",
+				Property:   k,
+				Err:        err,
+			})
 		}
 	}
 
-	return &fs, nil
+	return &fs, errs
 }
 
-func getPartition(obj dbus.BusObject) (*Partition, error) {
-	property := "org.freedesktop.UDisks2.Partition"
-
-	var store map[string]dbus.Variant
-
-	err := obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, property).Store(&store)
-
-	if err != nil && strings.Contains(err.Error(), "No such interface") {
-		return nil, nil
-	} else if err != nil {
-		return nil, fmt.Errorf("could not get property %s: %w", property, err)
-	}
-
+func decodePartition(path dbus.ObjectPath, props map[string]dbus.Variant) (*Partition, []error) {
 	var partition Partition
 
-	for k, v := range store {
+	var errs []error
+
+	for k, v := range props {
+		var err error
 		switch k {
 		case "Number":
-			val := v.Value().(uint32)
-			partition.Number = &val
+			err = store(v, &partition.Number)
 		case "Type":
-			val := v.Value().(string)
-			partition.Type = &val
+			err = store(v, &partition.Type)
 		case "Flags":
-			val := v.Value().(uint64)
-			partition.Flags = &val
+			err = store(v, &partition.Flags)
 		case "Offset":
-			val := v.Value().(uint64)
-			partition.Offset = &val
+			err = store(v, &partition.Offset)
 		case "Size":
-			val := v.Value().(uint64)
-			partition.Size = &val
+			err = store(v, &partition.Size)
 		case "Name":
-			val := v.Value().(string)
-			partition.Name = &val
+			err = store(v, &partition.Name)
 		case "UUID":
-			val := v.Value().(string)
-			partition.UUID = &val
+			err = store(v, &partition.UUID)
 		case "IsContainer":
-			val := v.Value().(bool)
-			partition.IsContainer = &val
+			err = store(v, &partition.IsContainer)
 		case "IsContained":
-			val := v.Value().(bool)
-			partition.IsContained = &val
+			err = store(v, &partition.IsContained)
+		case "Table":
+			err = storeObjectPath(v, &partition.Table)
+		}
+		if err != nil {
+			errs = append(errs, &DecodeError{
+				ObjectPath: string(path),
+				Interface:  "org.freedesktop.UDisks2.Partition",
+				Property:   k,
+				Err:        err,
+			})
+		}
+	}
+
+	return &partition, errs
+}
+
+func decodePartitionTable(path dbus.ObjectPath, props map[string]dbus.Variant) (*PartitionTable, []error) {
+	var table PartitionTable
+
+	var errs []error
+
+	for k, v := range props {
+		var err error
+		switch k {
+		case "Type":
+			err = store(v, &table.Type)
+		case "Partitions":
+			err = storeObjectPaths(v, &table.Partitions)
+		}
+		if err != nil {
+			errs = append(errs, &DecodeError{
+				ObjectPath: string(path),
+				Interface:  "org.freedesktop.UDisks2.PartitionTable",
+				Property:   k,
+				Err:        err,
+			})
 		}
 	}
 
-	return &partition, nil
+	return &table, errs
+}
+
+func store[T any](v dbus.Variant, dst **T) error {
+	val, ok := v.Value().(T)
+	if !ok {
+		return typeError[T](v)
+	}
+	*dst = &val
+	return nil
+}
+
+func storeBytestring(v dbus.Variant, dst **string) error {
+	b, ok := v.Value().([]byte)
+	if !ok {
+		return typeError[[]byte](v)
+	}
+	val := toString(b)
+	*dst = &val
+	return nil
+}
+
+func storeBytestrings(v dbus.Variant, dst **[]string) error {
+	bs, ok := v.Value().([][]byte)
+	if !ok {
+		return typeError[[][]byte](v)
+	}
+	val := make([]string, 0, len(bs))
+	for _, b := range bs {
+		val = append(val, toString(b))
+	}
+	*dst = &val
+	return nil
+}
+
+func storeObjectPath(v dbus.Variant, dst **string) error {
+	p, ok := v.Value().(dbus.ObjectPath)
+	if !ok {
+		return typeError[dbus.ObjectPath](v)
+	}
+	val := string(p)
+	*dst = &val
+	return nil
+}
+
+func storeObjectPaths(v dbus.Variant, dst **[]string) error {
+	ps, ok := v.Value().([]dbus.ObjectPath)
+	if !ok {
+		return typeError[[]dbus.ObjectPath](v)
+	}
+	val := make([]string, 0, len(ps))
+	for _, p := range ps {
+		val = append(val, string(p))
+	}
+	*dst = &val
+	return nil
+}
+
+func typeError[T any](v dbus.Variant) error {
+	var zero T
+	return fmt.Errorf("value of type %s is not of the expected type %s", v.Signature(), dbus.SignatureOf(zero))
 }
 
 func toString(b []byte) string {
@@ -0,0 +1,1116 @@
+// Package diskietest provides an in-memory udisks backend,
+// so that diskie can be used without udisksd and real devices.
+package diskietest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie"
+)
+
+// Backend is an in-memory diskie.Backend.
+// It implements the Mount, Unmount, Unlock, Lock, Eject, PowerOff,
+// GetBlockDevices, ResolveDevice, LoopSetup, Loop.Delete and Block.Format
+// methods of udisks, as well as Properties.Get,
+// changing its object tree and sending the signals udisksd would send.
+//
+// The cleartext devices of locked encrypted devices are kept aside,
+// and are added to the object tree when their encrypted device is unlocked.
+type Backend struct {
+	mu          sync.Mutex
+	objects     diskie.Objects
+	hidden      diskie.Objects
+	passphrases map[dbus.ObjectPath]string
+	busy        map[dbus.ObjectPath]bool
+	images      map[string]map[string]map[string]map[string]dbus.Variant
+	subscribers map[chan<- *dbus.Signal]chan<- *dbus.Signal
+
+	partitionScanDelay time.Duration
+}
+
+// Fixture is the JSON representation of a Backend.
+// Property values are in the GVariant text format
+// (e.g., "b'/dev/sda1'", "objectpath '/'", "uint64 1024", "@aay []"),
+// which is also how gdbus prints them.
+type Fixture struct {
+	// object path -> interface -> property -> value
+	Objects map[string]map[string]map[string]string
+
+	// object path of encrypted device -> passphrase.
+	// encrypted devices that aren't listed accept any passphrase.
+	Passphrases map[string]string
+
+	// object paths of filesystems that fail to unmount
+	// as if processes were using them. see Backend.SetBusy.
+	Busy []string
+
+	// path or base name of image file -> device -> interface -> property -> value.
+	// see Backend.AddImage.
+	Images map[string]map[string]map[string]map[string]string
+}
+
+// New creates a backend with the given object tree and passphrases.
+func New(objects diskie.Objects, passphrases map[string]string) *Backend {
+	b := &Backend{
+		objects:     copyObjects(objects),
+		hidden:      make(diskie.Objects),
+		passphrases: make(map[dbus.ObjectPath]string),
+		busy:        make(map[dbus.ObjectPath]bool),
+		images:      make(map[string]map[string]map[string]map[string]dbus.Variant),
+		subscribers: make(map[chan<- *dbus.Signal]chan<- *dbus.Signal),
+	}
+
+	for p, passphrase := range passphrases {
+		b.passphrases[dbus.ObjectPath(p)] = passphrase
+	}
+
+	for p, ifaces := range b.objects {
+		backing, has := objectPath(ifaces, "org.freedesktop.UDisks2.Block", "CryptoBackingDevice")
+		if !has || backing == "/" {
+			continue
+		}
+		cleartext, _ := objectPath(b.objects[backing], "org.freedesktop.UDisks2.Encrypted", "CleartextDevice")
+		if cleartext != p {
+			b.hidden[p] = ifaces
+			delete(b.objects, p)
+		}
+	}
+
+	return b
+}
+
+// Load creates a backend from the given JSON fixture file.
+func Load(file string) (*Backend, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read fixture: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse creates a backend from the given JSON fixture.
+func Parse(data []byte) (*Backend, error) {
+	var f Fixture
+
+	err := json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse fixture: %w", err)
+	}
+
+	objects := make(diskie.Objects, len(f.Objects))
+
+	for p, ifaces := range f.Objects {
+		if !dbus.ObjectPath(p).IsValid() {
+			return nil, fmt.Errorf("invalid object path in fixture: %q", p)
+		}
+		parsed, err := parseInterfaces(p, ifaces)
+		if err != nil {
+			return nil, err
+		}
+		objects[dbus.ObjectPath(p)] = parsed
+	}
+
+	b := New(objects, f.Passphrases)
+
+	for _, p := range f.Busy {
+		b.SetBusy(p, true)
+	}
+
+	for file, devices := range f.Images {
+		parsed := make(map[string]map[string]map[string]dbus.Variant, len(devices))
+		for device, ifaces := range devices {
+			var err error
+			parsed[device], err = parseInterfaces(file+":"+device, ifaces)
+			if err != nil {
+				return nil, err
+			}
+		}
+		b.AddImage(file, parsed)
+	}
+
+	return b, nil
+}
+
+func parseInterfaces(p string, ifaces map[string]map[string]string) (map[string]map[string]dbus.Variant, error) {
+	parsed := make(map[string]map[string]dbus.Variant, len(ifaces))
+	for iface, props := range ifaces {
+		parsed[iface] = make(map[string]dbus.Variant, len(props))
+		for k, s := range props {
+			v, err := dbus.ParseVariant(s, dbus.Signature{})
+			if err != nil {
+				return nil, fmt.Errorf("could not parse property %s of %s on %s: %w", k, iface, p, err)
+			}
+			parsed[iface][k] = v
+		}
+	}
+	return parsed, nil
+}
+
+// SetBusy makes unmounting the filesystem at objectPath fail
+// with org.freedesktop.UDisks2.Error.DeviceBusy, as if processes were using it.
+func (b *Backend) SetBusy(objectPath string, busy bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.busy[dbus.ObjectPath(objectPath)] = busy
+}
+
+// SetPartitionScanDelay makes LoopSetup return before the partition table
+// and the partitions of the loop device are added,
+// and adds them after the given delay instead,
+// like udisksd does once the kernel has scanned the partitions.
+func (b *Backend) SetPartitionScanDelay(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.partitionScanDelay = d
+}
+
+// AddImage sets the contents that loop devices backed by file are given,
+// since the backend doesn't probe files.
+// file is matched against the path or the base name of the backing file.
+//
+// devices maps "" to the interfaces of the loop device itself,
+// and partition names such as "p1" to the interfaces of its partitions.
+// the Block and Loop properties that every loop device has are filled in,
+// and so is the Table property of the partitions.
+func (b *Backend) AddImage(file string, devices map[string]map[string]map[string]dbus.Variant) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.images[file] = devices
+}
+
+func (b *Backend) ManagedObjects(ctx context.Context) (diskie.Objects, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return copyObjects(b.objects), nil
+}
+
+func (b *Backend) Call(ctx context.Context, objectPath dbus.ObjectPath, method string, args []any, ret ...any) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ifaces, has := b.objects[objectPath]
+	if !has {
+		return newError("org.freedesktop.DBus.Error.UnknownObject", "No such object path '%s'", objectPath)
+	}
+
+	i := strings.LastIndexByte(method, '.')
+	if i < 0 {
+		return newError("org.freedesktop.DBus.Error.UnknownMethod", "Invalid method %s", method)
+	}
+
+	if method == "org.freedesktop.DBus.Properties.Get" {
+		var iface, k string
+		if len(args) > 1 {
+			iface, _ = args[0].(string)
+			k, _ = args[1].(string)
+		}
+		v, has := ifaces[iface][k]
+		if !has {
+			return newError("org.freedesktop.DBus.Error.InvalidArgs", "No such property '%s' on interface '%s'", k, iface)
+		}
+		return dbus.Store([]any{v}, ret...)
+	}
+
+	_, has = ifaces[method[:i]]
+	if !has {
+		return newError("org.freedesktop.DBus.Error.UnknownMethod", "No such interface '%s' on object at path %s", method[:i], objectPath)
+	}
+
+	var result any
+
+	switch method {
+	case "org.freedesktop.UDisks2.Filesystem.Mount":
+		result, err = b.mount(objectPath)
+	case "org.freedesktop.UDisks2.Filesystem.Unmount":
+		err = b.unmount(objectPath)
+	case "org.freedesktop.UDisks2.Encrypted.Unlock":
+		var passphrase string
+		var options map[string]dbus.Variant
+		if len(args) > 1 {
+			passphrase, _ = args[0].(string)
+			options, _ = args[1].(map[string]dbus.Variant)
+		}
+		keyfile, has := options["keyfile_contents"].Value().([]byte)
+		if has {
+			passphrase = string(keyfile)
+		}
+		result, err = b.unlock(objectPath, passphrase)
+	case "org.freedesktop.UDisks2.Encrypted.Lock":
+		err = b.lock(objectPath)
+	case "org.freedesktop.UDisks2.Drive.Eject":
+		err = b.eject(objectPath)
+	case "org.freedesktop.UDisks2.Drive.PowerOff":
+		err = b.powerOff(objectPath)
+	case "org.freedesktop.UDisks2.Manager.GetBlockDevices":
+		result = b.blockDevices()
+	case "org.freedesktop.UDisks2.Manager.ResolveDevice":
+		var devspec map[string]dbus.Variant
+		if len(args) > 0 {
+			devspec, _ = args[0].(map[string]dbus.Variant)
+		}
+		result = b.resolveDevice(devspec)
+	case "org.freedesktop.UDisks2.Manager.LoopSetup":
+		var fd dbus.UnixFD
+		var options map[string]dbus.Variant
+		if len(args) > 1 {
+			fd, _ = args[0].(dbus.UnixFD)
+			options, _ = args[1].(map[string]dbus.Variant)
+		}
+		result, err = b.loopSetup(fd, options)
+	case "org.freedesktop.UDisks2.Loop.Delete":
+		err = b.loopDelete(objectPath)
+	case "org.freedesktop.UDisks2.Block.Format":
+		var fsType string
+		var options map[string]dbus.Variant
+		if len(args) > 1 {
+			fsType, _ = args[0].(string)
+			options, _ = args[1].(map[string]dbus.Variant)
+		}
+		err = b.format(objectPath, fsType, options)
+	default:
+		return newError("org.freedesktop.DBus.Error.UnknownMethod", "Method %s is not implemented by diskietest", method)
+	}
+
+	if err != nil || len(ret) == 0 {
+		return err
+	}
+
+	return dbus.Store([]any{result}, ret...)
+}
+
+func (b *Backend) Subscribe(signals chan<- *dbus.Signal) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	queue := make(chan *dbus.Signal)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	b.subscribers[signals] = queue
+
+	// signals are queued for each subscriber and sent in order,
+	// so that a slow subscriber neither loses signals nor holds up the backend.
+	go func() {
+		defer close(stopped)
+
+		var pending []*dbus.Signal
+
+		for {
+			var out chan<- *dbus.Signal
+			var next *dbus.Signal
+			if len(pending) > 0 {
+				out = signals
+				next = pending[0]
+			}
+
+			select {
+			case <-done:
+				return
+			case sig := <-queue:
+				pending = append(pending, sig)
+			case out <- next:
+				pending[0] = nil
+				pending = pending[1:]
+			}
+		}
+	}()
+
+	// no signal is sent on the channel after unsubscribe returns.
+	unsubscribe := func() {
+		b.mu.Lock()
+		_, has := b.subscribers[signals]
+		delete(b.subscribers, signals)
+		b.mu.Unlock()
+
+		if has {
+			close(done)
+		}
+		<-stopped
+	}
+
+	return unsubscribe, nil
+}
+
+func (b *Backend) mount(p dbus.ObjectPath) (string, error) {
+	device := b.device(p)
+
+	mountpoints := b.mountpoints(p)
+	if len(mountpoints) > 0 {
+		return "", newError("org.freedesktop.UDisks2.Error.AlreadyMounted", "Device %s is already mounted at `%s'.", device, bytes.TrimRight(mountpoints[0], "\x00"))
+	}
+
+	name := path.Base(device)
+	for _, k := range []string{"IdLabel", "IdUUID"} {
+		v, _ := b.objects[p]["org.freedesktop.UDisks2.Block"][k].Value().(string)
+		if v != "" {
+			name = v
+			break
+		}
+	}
+
+	mountpoint := path.Join("/run/media/diskie", name)
+
+	b.setProperty(p, "org.freedesktop.UDisks2.Filesystem", "MountPoints", dbus.MakeVariant([][]byte{bytestring(mountpoint)}))
+
+	return mountpoint, nil
+}
+
+func (b *Backend) unmount(p dbus.ObjectPath) error {
+	mountpoints := b.mountpoints(p)
+	if len(mountpoints) == 0 {
+		return newError("org.freedesktop.UDisks2.Error.NotMounted", "Device `%s' is not mounted", b.device(p))
+	}
+
+	if b.busy[p] {
+		return newError("org.freedesktop.UDisks2.Error.DeviceBusy", "Error unmounting %s: target is busy", b.device(p))
+	}
+
+	b.setProperty(p, "org.freedesktop.UDisks2.Filesystem", "MountPoints", dbus.MakeVariant([][]byte{}))
+
+	return nil
+}
+
+func (b *Backend) unlock(p dbus.ObjectPath, passphrase string) (dbus.ObjectPath, error) {
+	device := b.device(p)
+
+	cleartext, _ := objectPath(b.objects[p], "org.freedesktop.UDisks2.Encrypted", "CleartextDevice")
+	if cleartext != "" && cleartext != "/" {
+		return "", newError("org.freedesktop.UDisks2.Error.Failed", "Device %s is already unlocked as %s", device, b.device(cleartext))
+	}
+
+	want, has := b.passphrases[p]
+	if has && passphrase != want {
+		return "", newError("org.freedesktop.UDisks2.Error.Failed", "Error unlocking %s: Failed to activate device: Incorrect passphrase", device)
+	}
+
+	for hp, ifaces := range b.hidden {
+		backing, _ := objectPath(ifaces, "org.freedesktop.UDisks2.Block", "CryptoBackingDevice")
+		if backing == p {
+			cleartext = hp
+			break
+		}
+	}
+
+	if cleartext == "" || cleartext == "/" {
+		cleartext = b.newCleartext(p)
+	}
+
+	b.objects[cleartext] = b.hidden[cleartext]
+	delete(b.hidden, cleartext)
+
+	b.emit(&dbus.Signal{
+		Path: "/org/freedesktop/UDisks2",
+		Name: "org.freedesktop.DBus.ObjectManager.InterfacesAdded",
+		Body: []any{cleartext, copyInterfaces(b.objects[cleartext])},
+	})
+
+	b.setProperty(p, "org.freedesktop.UDisks2.Encrypted", "CleartextDevice", dbus.MakeVariant(cleartext))
+
+	return cleartext, nil
+}
+
+func (b *Backend) lock(p dbus.ObjectPath) error {
+	device := b.device(p)
+
+	cleartext, _ := objectPath(b.objects[p], "org.freedesktop.UDisks2.Encrypted", "CleartextDevice")
+	if cleartext == "" || cleartext == "/" {
+		return newError("org.freedesktop.UDisks2.Error.Failed", "Device %s is not unlocked", device)
+	}
+
+	if len(b.mountpoints(cleartext)) > 0 {
+		return newError("org.freedesktop.UDisks2.Error.DeviceBusy", "Error locking %s (%s): Failed to deactivate device: Device or resource busy", device, b.device(cleartext))
+	}
+
+	ifaces := b.objects[cleartext]
+	b.hidden[cleartext] = ifaces
+	delete(b.objects, cleartext)
+
+	removed := make([]string, 0, len(ifaces))
+	for iface := range ifaces {
+		removed = append(removed, iface)
+	}
+
+	b.emit(&dbus.Signal{
+		Path: "/org/freedesktop/UDisks2",
+		Name: "org.freedesktop.DBus.ObjectManager.InterfacesRemoved",
+		Body: []any{cleartext, removed},
+	})
+
+	b.setProperty(p, "org.freedesktop.UDisks2.Encrypted", "CleartextDevice", dbus.MakeVariant(dbus.ObjectPath("/")))
+
+	return nil
+}
+
+// eject removes the media of the drive.
+func (b *Backend) eject(p dbus.ObjectPath) error {
+	err := b.checkDriveUnused(p)
+	if err != nil {
+		return err
+	}
+
+	for _, bp := range b.driveBlocks(p) {
+		_, has := b.objects[bp]["org.freedesktop.UDisks2.Filesystem"]
+		if has {
+			delete(b.objects[bp], "org.freedesktop.UDisks2.Filesystem")
+			b.emit(&dbus.Signal{
+				Path: "/org/freedesktop/UDisks2",
+				Name: "org.freedesktop.DBus.ObjectManager.InterfacesRemoved",
+				Body: []any{bp, []string{"org.freedesktop.UDisks2.Filesystem"}},
+			})
+		}
+		for _, k := range []string{"IdUsage", "IdType", "IdLabel", "IdUUID"} {
+			b.setProperty(bp, "org.freedesktop.UDisks2.Block", k, dbus.MakeVariant(""))
+		}
+		b.setProperty(bp, "org.freedesktop.UDisks2.Block", "Size", dbus.MakeVariant(uint64(0)))
+	}
+
+	b.setProperty(p, "org.freedesktop.UDisks2.Drive", "MediaAvailable", dbus.MakeVariant(false))
+
+	return nil
+}
+
+// powerOff removes the drive and its block devices.
+func (b *Backend) powerOff(p dbus.ObjectPath) error {
+	canPowerOff, _ := b.objects[p]["org.freedesktop.UDisks2.Drive"]["CanPowerOff"].Value().(bool)
+	if !canPowerOff {
+		return newError("org.freedesktop.UDisks2.Error.Failed", "Error powering off drive: the drive cannot be powered off")
+	}
+
+	err := b.checkDriveUnused(p)
+	if err != nil {
+		return err
+	}
+
+	for _, bp := range append(b.driveBlocks(p), p) {
+		for hp, ifaces := range b.hidden {
+			backing, _ := objectPath(ifaces, "org.freedesktop.UDisks2.Block", "CryptoBackingDevice")
+			if backing == bp {
+				delete(b.hidden, hp)
+			}
+		}
+
+		removed := make([]string, 0, len(b.objects[bp]))
+		for iface := range b.objects[bp] {
+			removed = append(removed, iface)
+		}
+		delete(b.objects, bp)
+
+		b.emit(&dbus.Signal{
+			Path: "/org/freedesktop/UDisks2",
+			Name: "org.freedesktop.DBus.ObjectManager.InterfacesRemoved",
+			Body: []any{bp, removed},
+		})
+	}
+
+	return nil
+}
+
+// loopSetup adds a loop device backed by the file that fd refers to,
+// along with the partitions of its image (see AddImage).
+func (b *Backend) loopSetup(fd dbus.UnixFD, options map[string]dbus.Variant) (dbus.ObjectPath, error) {
+	file, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil {
+		return "", newError("org.freedesktop.UDisks2.Error.Failed", "Error creating loop device: %s", err)
+	}
+
+	var st syscall.Stat_t
+	err = syscall.Fstat(int(fd), &st)
+	if err != nil {
+		return "", newError("org.freedesktop.UDisks2.Error.Failed", "Error creating loop device: %s", err)
+	}
+
+	offset, _ := options["offset"].Value().(uint64)
+	size, _ := options["size"].Value().(uint64)
+	readOnly, _ := options["read-only"].Value().(bool)
+	noPartScan, _ := options["no-part-scan"].Value().(bool)
+
+	if size == 0 && uint64(st.Size) > offset {
+		size = uint64(st.Size) - offset
+	}
+
+	n := 0
+	for b.objects[dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/UDisks2/block_devices/loop%d", n))] != nil {
+		n++
+	}
+
+	loop := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/UDisks2/block_devices/loop%d", n))
+
+	image, has := b.images[file]
+	if !has {
+		image = b.images[path.Base(file)]
+	}
+
+	var names []string
+	for name := range image {
+		if name != "" && !noPartScan {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	partitions := make([]dbus.ObjectPath, 0, len(names))
+	for _, name := range names {
+		partitions = append(partitions, loop+dbus.ObjectPath(name))
+	}
+
+	ifaces := map[string]map[string]dbus.Variant{
+		"org.freedesktop.UDisks2.Block": loopBlock(fmt.Sprintf("/dev/loop%d", n), size, readOnly),
+		"org.freedesktop.UDisks2.Loop": {
+			"BackingFile": dbus.MakeVariant(bytestring(file)),
+			"Autoclear":   dbus.MakeVariant(false),
+			"SetupByUID":  dbus.MakeVariant(uint32(os.Getuid())),
+		},
+	}
+	table := map[string]dbus.Variant{
+		"Type":       dbus.MakeVariant("dos"),
+		"Partitions": dbus.MakeVariant(partitions),
+	}
+	if len(partitions) > 0 && b.partitionScanDelay == 0 {
+		ifaces["org.freedesktop.UDisks2.PartitionTable"] = table
+	}
+	mergeInterfaces(ifaces, image[""])
+
+	b.objects[loop] = ifaces
+	b.emit(&dbus.Signal{
+		Path: "/org/freedesktop/UDisks2",
+		Name: "org.freedesktop.DBus.ObjectManager.InterfacesAdded",
+		Body: []any{loop, copyInterfaces(ifaces)},
+	})
+
+	addPartitions := func() {
+		for i, p := range partitions {
+			ifaces := map[string]map[string]dbus.Variant{
+				"org.freedesktop.UDisks2.Block": loopBlock(fmt.Sprintf("/dev/loop%d%s", n, names[i]), 0, readOnly),
+				"org.freedesktop.UDisks2.Partition": {
+					"Number": dbus.MakeVariant(uint32(i + 1)),
+					"Table":  dbus.MakeVariant(loop),
+				},
+			}
+			mergeInterfaces(ifaces, image[names[i]])
+
+			b.objects[p] = ifaces
+			b.emit(&dbus.Signal{
+				Path: "/org/freedesktop/UDisks2",
+				Name: "org.freedesktop.DBus.ObjectManager.InterfacesAdded",
+				Body: []any{p, copyInterfaces(ifaces)},
+			})
+		}
+	}
+
+	if len(partitions) == 0 {
+		return loop, nil
+	}
+
+	if b.partitionScanDelay == 0 {
+		addPartitions()
+		return loop, nil
+	}
+
+	go func() {
+		time.Sleep(b.partitionScanDelay)
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		// the loop device may have been deleted in the meantime
+		if b.objects[loop] == nil {
+			return
+		}
+
+		b.addInterface(loop, "org.freedesktop.UDisks2.PartitionTable", table)
+		addPartitions()
+	}()
+
+	return loop, nil
+}
+
+// loopDelete removes the loop device and its partitions.
+func (b *Backend) loopDelete(p dbus.ObjectPath) error {
+	// the partitions are removed before the loop device
+	var paths []dbus.ObjectPath
+	for bp, ifaces := range b.objects {
+		table, _ := objectPath(ifaces, "org.freedesktop.UDisks2.Partition", "Table")
+		if table == p {
+			paths = append(paths, bp)
+		}
+	}
+	slices.Sort(paths)
+	paths = append(paths, p)
+
+	for _, bp := range paths {
+		if len(b.mountpoints(bp)) > 0 {
+			return newError("org.freedesktop.UDisks2.Error.DeviceBusy", "Error deleting loop device %s: Device %s is mounted", b.device(p), b.device(bp))
+		}
+	}
+
+	for _, bp := range paths {
+		removed := make([]string, 0, len(b.objects[bp]))
+		for iface := range b.objects[bp] {
+			removed = append(removed, iface)
+		}
+		delete(b.objects, bp)
+
+		b.emit(&dbus.Signal{
+			Path: "/org/freedesktop/UDisks2",
+			Name: "org.freedesktop.DBus.ObjectManager.InterfacesRemoved",
+			Body: []any{bp, removed},
+		})
+	}
+
+	return nil
+}
+
+// format replaces the contents of the device.
+// the filesystems on the device and its partitions must be unmounted
+// and its encrypted devices locked, unless the tear-down option is given.
+// the data is not erased, so the erase option is ignored.
+func (b *Backend) format(p dbus.ObjectPath, fsType string, options map[string]dbus.Variant) error {
+	device := b.device(p)
+
+	label, _ := options["label"].Value().(string)
+	passphrase, _ := options["encrypt.passphrase"].Value().(string)
+	if v, has := options["encrypt.passphrase"].Value().([]byte); has {
+		passphrase = string(v)
+	}
+	encryptType, _ := options["encrypt.type"].Value().(string)
+	tearDown, _ := options["tear-down"].Value().(bool)
+
+	switch fsType {
+	case "empty", "dos", "gpt":
+		if passphrase != "" {
+			return newError("org.freedesktop.UDisks2.Error.NotSupported", "Encryption is not supported for type %s", fsType)
+		}
+	case "swap":
+	default:
+		supported, has := b.objects["/org/freedesktop/UDisks2/Manager"]["org.freedesktop.UDisks2.Manager"]["SupportedFilesystems"].Value().([]string)
+		if has && !slices.Contains(supported, fsType) {
+			return newError("org.freedesktop.UDisks2.Error.NotSupported", "Creation of file system type %s is not supported", fsType)
+		}
+	}
+
+	var partitions []dbus.ObjectPath
+	for bp, ifaces := range b.objects {
+		table, _ := objectPath(ifaces, "org.freedesktop.UDisks2.Partition", "Table")
+		if table == p {
+			partitions = append(partitions, bp)
+		}
+	}
+	slices.Sort(partitions)
+
+	for _, bp := range append(partitions, p) {
+		cleartext, _ := objectPath(b.objects[bp], "org.freedesktop.UDisks2.Encrypted", "CleartextDevice")
+		unlocked := cleartext != "" && cleartext != "/"
+		mounted := len(b.mountpoints(bp)) > 0
+
+		if !tearDown && (unlocked || mounted) {
+			return newError("org.freedesktop.UDisks2.Error.DeviceBusy", "Error formatting %s: Device %s is in use", device, b.device(bp))
+		}
+		if unlocked && len(b.mountpoints(cleartext)) > 0 {
+			err := b.unmount(cleartext)
+			if err != nil {
+				return err
+			}
+		}
+		if unlocked {
+			err := b.lock(bp)
+			if err != nil {
+				return err
+			}
+		}
+		if mounted {
+			err := b.unmount(bp)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// the old contents are gone, along with the cleartext devices kept aside for them
+	for _, bp := range partitions {
+		ifaces := make([]string, 0, len(b.objects[bp]))
+		for iface := range b.objects[bp] {
+			ifaces = append(ifaces, iface)
+		}
+		b.removeInterfaces(bp, ifaces...)
+	}
+	for hp, ifaces := range b.hidden {
+		backing, _ := objectPath(ifaces, "org.freedesktop.UDisks2.Block", "CryptoBackingDevice")
+		if backing == p || slices.Contains(partitions, backing) {
+			delete(b.hidden, hp)
+		}
+	}
+	delete(b.passphrases, p)
+	b.removeInterfaces(p,
+		"org.freedesktop.UDisks2.PartitionTable",
+		"org.freedesktop.UDisks2.Filesystem",
+		"org.freedesktop.UDisks2.Encrypted",
+	)
+
+	ids := map[string]string{
+		"IdUsage": "",
+		"IdType":  "",
+		"IdLabel": "",
+		"IdUUID":  "",
+	}
+
+	size, _ := b.objects[p]["org.freedesktop.UDisks2.Block"]["Size"].Value().(uint64)
+
+	switch {
+	case fsType == "empty":
+	case fsType == "dos" || fsType == "gpt":
+		b.addInterface(p, "org.freedesktop.UDisks2.PartitionTable", map[string]dbus.Variant{
+			"Type":       dbus.MakeVariant(fsType),
+			"Partitions": dbus.MakeVariant([]dbus.ObjectPath{}),
+		})
+	case passphrase != "":
+		if encryptType == "" {
+			encryptType = "luks2"
+		}
+		ids["IdUsage"] = "crypto"
+		ids["IdType"] = "crypto_LUKS"
+		ids["IdUUID"] = newUUID()
+		b.passphrases[p] = passphrase
+		b.addInterface(p, "org.freedesktop.UDisks2.Encrypted", map[string]dbus.Variant{
+			"HintEncryptionType": dbus.MakeVariant(encryptType),
+			"MetadataSize":       dbus.MakeVariant(uint64(16777216)),
+			"CleartextDevice":    dbus.MakeVariant(dbus.ObjectPath("/")),
+		})
+
+		// the filesystem is inside the cleartext device
+		cleartext := b.newCleartext(p)
+		block := b.hidden[cleartext]["org.freedesktop.UDisks2.Block"]
+		block["Size"] = dbus.MakeVariant(size - min(size, 16777216))
+		block["IdUsage"] = dbus.MakeVariant("filesystem")
+		block["IdType"] = dbus.MakeVariant(fsType)
+		block["IdLabel"] = dbus.MakeVariant(label)
+		block["IdUUID"] = dbus.MakeVariant(newUUID())
+		b.hidden[cleartext]["org.freedesktop.UDisks2.Filesystem"] = map[string]dbus.Variant{
+			"MountPoints": dbus.MakeVariant([][]byte{}),
+			"Size":        dbus.MakeVariant(size - min(size, 16777216)),
+		}
+	case fsType == "swap":
+		ids["IdUsage"] = "other"
+		ids["IdType"] = "swap"
+		ids["IdLabel"] = label
+		ids["IdUUID"] = newUUID()
+	default:
+		ids["IdUsage"] = "filesystem"
+		ids["IdType"] = fsType
+		ids["IdLabel"] = label
+		ids["IdUUID"] = newUUID()
+		b.addInterface(p, "org.freedesktop.UDisks2.Filesystem", map[string]dbus.Variant{
+			"MountPoints": dbus.MakeVariant([][]byte{}),
+			"Size":        dbus.MakeVariant(size),
+		})
+	}
+
+	for k, v := range ids {
+		b.setProperty(p, "org.freedesktop.UDisks2.Block", k, dbus.MakeVariant(v))
+	}
+
+	return nil
+}
+
+// addInterface adds an interface to the object and sends InterfacesAdded.
+func (b *Backend) addInterface(p dbus.ObjectPath, iface string, props map[string]dbus.Variant) {
+	b.objects[p][iface] = props
+
+	b.emit(&dbus.Signal{
+		Path: "/org/freedesktop/UDisks2",
+		Name: "org.freedesktop.DBus.ObjectManager.InterfacesAdded",
+		Body: []any{p, copyInterfaces(map[string]map[string]dbus.Variant{iface: props})},
+	})
+}
+
+// removeInterfaces removes the interfaces that the object has
+// and sends InterfacesRemoved.
+// the object is removed once it has no interfaces left.
+func (b *Backend) removeInterfaces(p dbus.ObjectPath, ifaces ...string) {
+	var removed []string
+	for _, iface := range ifaces {
+		_, has := b.objects[p][iface]
+		if has {
+			delete(b.objects[p], iface)
+			removed = append(removed, iface)
+		}
+	}
+
+	if len(b.objects[p]) == 0 {
+		delete(b.objects, p)
+	}
+
+	if len(removed) == 0 {
+		return
+	}
+
+	b.emit(&dbus.Signal{
+		Path: "/org/freedesktop/UDisks2",
+		Name: "org.freedesktop.DBus.ObjectManager.InterfacesRemoved",
+		Body: []any{p, removed},
+	})
+}
+
+// loopBlock returns the Block properties of a loop device or its partition.
+func loopBlock(device string, size uint64, readOnly bool) map[string]dbus.Variant {
+	return map[string]dbus.Variant{
+		"Device":              dbus.MakeVariant(bytestring(device)),
+		"PreferredDevice":     dbus.MakeVariant(bytestring(device)),
+		"Symlinks":            dbus.MakeVariant([][]byte{}),
+		"Size":                dbus.MakeVariant(size),
+		"ReadOnly":            dbus.MakeVariant(readOnly),
+		"Drive":               dbus.MakeVariant(dbus.ObjectPath("/")),
+		"CryptoBackingDevice": dbus.MakeVariant(dbus.ObjectPath("/")),
+		"IdUsage":             dbus.MakeVariant(""),
+		"IdType":              dbus.MakeVariant(""),
+		"IdLabel":             dbus.MakeVariant(""),
+		"IdUUID":              dbus.MakeVariant(""),
+		"HintPartitionable":   dbus.MakeVariant(true),
+		"HintSystem":          dbus.MakeVariant(false),
+		"HintIgnore":          dbus.MakeVariant(false),
+		"HintAuto":            dbus.MakeVariant(true),
+	}
+}
+
+// mergeInterfaces adds the interfaces and properties of src to dst,
+// replacing the properties that are in both.
+func mergeInterfaces(dst map[string]map[string]dbus.Variant, src map[string]map[string]dbus.Variant) {
+	for iface, props := range src {
+		if dst[iface] == nil {
+			dst[iface] = make(map[string]dbus.Variant, len(props))
+		}
+		for k, v := range props {
+			dst[iface][k] = v
+		}
+	}
+}
+
+// checkDriveUnused returns an error if a block device of the drive
+// is mounted or unlocked.
+func (b *Backend) checkDriveUnused(p dbus.ObjectPath) error {
+	for _, bp := range b.driveBlocks(p) {
+		if len(b.mountpoints(bp)) > 0 {
+			return newError("org.freedesktop.UDisks2.Error.DeviceBusy", "Device %s is mounted", b.device(bp))
+		}
+		cleartext, _ := objectPath(b.objects[bp], "org.freedesktop.UDisks2.Encrypted", "CleartextDevice")
+		if cleartext != "" && cleartext != "/" {
+			return newError("org.freedesktop.UDisks2.Error.DeviceBusy", "Device %s is unlocked", b.device(bp))
+		}
+	}
+	return nil
+}
+
+// driveBlocks returns the block devices of the drive, in order.
+func (b *Backend) driveBlocks(p dbus.ObjectPath) []dbus.ObjectPath {
+	var paths []dbus.ObjectPath
+	for bp, ifaces := range b.objects {
+		drive, _ := objectPath(ifaces, "org.freedesktop.UDisks2.Block", "Drive")
+		if drive == p {
+			paths = append(paths, bp)
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// blockDevices returns the object paths of the block devices, in order.
+func (b *Backend) blockDevices() []dbus.ObjectPath {
+	paths := []dbus.ObjectPath{}
+	for p, ifaces := range b.objects {
+		_, has := ifaces["org.freedesktop.UDisks2.Block"]
+		if has {
+			paths = append(paths, p)
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// resolveDevice returns the block devices that match all of the keys of devspec.
+func (b *Backend) resolveDevice(devspec map[string]dbus.Variant) []dbus.ObjectPath {
+	paths := []dbus.ObjectPath{}
+
+	for p, ifaces := range b.objects {
+		block, has := ifaces["org.freedesktop.UDisks2.Block"]
+		if !has || len(devspec) == 0 {
+			continue
+		}
+
+		match := true
+
+		for k, v := range devspec {
+			want, _ := v.Value().(string)
+			switch k {
+			case "path":
+				found := false
+				for _, prop := range []string{"Device", "PreferredDevice"} {
+					v, _ := block[prop].Value().([]byte)
+					found = found || string(bytes.TrimRight(v, "\x00")) == want
+				}
+				symlinks, _ := block["Symlinks"].Value().([][]byte)
+				for _, v := range symlinks {
+					found = found || string(bytes.TrimRight(v, "\x00")) == want
+				}
+				match = match && found
+			case "uuid":
+				v, _ := block["IdUUID"].Value().(string)
+				match = match && v == want
+			case "label":
+				v, _ := block["IdLabel"].Value().(string)
+				match = match && v == want
+			case "partuuid":
+				v, _ := ifaces["org.freedesktop.UDisks2.Partition"]["UUID"].Value().(string)
+				match = match && v == want
+			default:
+				match = false
+			}
+		}
+
+		if match {
+			paths = append(paths, p)
+		}
+	}
+
+	slices.Sort(paths)
+
+	return paths
+}
+
+// newCleartext adds a bare cleartext device for the encrypted device
+// to the hidden objects, for encrypted devices that have none in the fixture.
+func (b *Backend) newCleartext(backing dbus.ObjectPath) dbus.ObjectPath {
+	n := 0
+	for {
+		p := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/UDisks2/block_devices/dm_2d%d", n))
+		_, inObjects := b.objects[p]
+		_, inHidden := b.hidden[p]
+		if !inObjects && !inHidden {
+			break
+		}
+		n++
+	}
+
+	p := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/UDisks2/block_devices/dm_2d%d", n))
+	device := fmt.Sprintf("/dev/dm-%d", n)
+
+	block := map[string]dbus.Variant{
+		"Device":              dbus.MakeVariant(bytestring(device)),
+		"PreferredDevice":     dbus.MakeVariant(bytestring(device)),
+		"Symlinks":            dbus.MakeVariant([][]byte{}),
+		"Drive":               dbus.MakeVariant(dbus.ObjectPath("/")),
+		"CryptoBackingDevice": dbus.MakeVariant(backing),
+		"IdUsage":             dbus.MakeVariant(""),
+		"IdType":              dbus.MakeVariant(""),
+		"IdLabel":             dbus.MakeVariant(""),
+		"IdUUID":              dbus.MakeVariant(""),
+		"HintSystem":          dbus.MakeVariant(false),
+		"HintIgnore":          dbus.MakeVariant(false),
+		"HintAuto":            dbus.MakeVariant(false),
+	}
+
+	size, has := b.objects[backing]["org.freedesktop.UDisks2.Block"]["Size"]
+	if has {
+		block["Size"] = size
+	}
+
+	b.hidden[p] = map[string]map[string]dbus.Variant{
+		"org.freedesktop.UDisks2.Block": block,
+	}
+
+	return p
+}
+
+// setProperty changes a property and sends PropertiesChanged.
+func (b *Backend) setProperty(p dbus.ObjectPath, iface string, k string, v dbus.Variant) {
+	props, has := b.objects[p][iface]
+	if !has {
+		return
+	}
+
+	props[k] = v
+
+	b.emit(&dbus.Signal{
+		Path: p,
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []any{iface, map[string]dbus.Variant{k: v}, []string{}},
+	})
+}
+
+// emit queues the signal for the subscribers.
+// like the bus, it never drops signals or reorders them.
+func (b *Backend) emit(sig *dbus.Signal) {
+	sig.Sender = "org.freedesktop.UDisks2"
+	for _, queue := range b.subscribers {
+		queue <- sig
+	}
+}
+
+func (b *Backend) device(p dbus.ObjectPath) string {
+	v, _ := b.objects[p]["org.freedesktop.UDisks2.Block"]["Device"].Value().([]byte)
+	return string(bytes.TrimRight(v, "\x00"))
+}
+
+func (b *Backend) mountpoints(p dbus.ObjectPath) [][]byte {
+	v, _ := b.objects[p]["org.freedesktop.UDisks2.Filesystem"]["MountPoints"].Value().([][]byte)
+	return v
+}
+
+func objectPath(ifaces map[string]map[string]dbus.Variant, iface string, k string) (dbus.ObjectPath, bool) {
+	v, has := ifaces[iface][k].Value().(dbus.ObjectPath)
+	return v, has
+}
+
+func newUUID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+func bytestring(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+// newError returns a dbus.Error value, like godbus does for error replies.
+func newError(name string, format string, a ...any) error {
+	return dbus.Error{
+		Name: name,
+		Body: []any{fmt.Sprintf(format, a...)},
+	}
+}
+
+func copyObjects(objects diskie.Objects) diskie.Objects {
+	c := make(diskie.Objects, len(objects))
+	for p, ifaces := range objects {
+		c[p] = copyInterfaces(ifaces)
+	}
+	return c
+}
+
+func copyInterfaces(ifaces map[string]map[string]dbus.Variant) map[string]map[string]dbus.Variant {
+	c := make(map[string]map[string]dbus.Variant, len(ifaces))
+	for iface, props := range ifaces {
+		c[iface] = make(map[string]dbus.Variant, len(props))
+		for k, v := range props {
+			c[iface][k] = v
+		}
+	}
+	return c
+}
@@ -0,0 +1,95 @@
+package diskietest
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Bus is a private dbus-daemon, for running services
+// such as org.freedesktop.UDisks2 or org.freedesktop.Notifications
+// without touching the buses of the machine.
+type Bus struct {
+	Address string
+
+	dir    string
+	daemon *exec.Cmd
+}
+
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// StartBus starts a dbus-daemon that listens on a socket in a temporary directory.
+// dbus-daemon must be in PATH.
+func StartBus() (*Bus, error) {
+	dir, err := os.MkdirTemp("", "diskietest-")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary directory: %w", err)
+	}
+
+	b := &Bus{
+		dir: dir,
+	}
+
+	err = b.start()
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *Bus) start() error {
+	config := filepath.Join(b.dir, "bus.conf")
+
+	err := os.WriteFile(config, []byte(fmt.Sprintf(busConfig, filepath.Join(b.dir, "bus"))), 0o600)
+	if err != nil {
+		return fmt.Errorf("could not write dbus-daemon config: %w", err)
+	}
+
+	b.daemon = exec.Command("dbus-daemon", "--config-file="+config, "--nofork", "--print-address=1")
+	b.daemon.Stderr = os.Stderr
+
+	stdout, err := b.daemon.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("could not start dbus-daemon: %w", err)
+	}
+
+	err = b.daemon.Start()
+	if err != nil {
+		return fmt.Errorf("could not start dbus-daemon: %w", err)
+	}
+
+	// dbus-daemon prints its address once it's ready
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("could not read the address of dbus-daemon: %w", err)
+	}
+	b.Address = strings.TrimSpace(address)
+
+	return nil
+}
+
+// Close stops dbus-daemon.
+func (b *Bus) Close() error {
+	if b.daemon != nil && b.daemon.Process != nil {
+		b.daemon.Process.Kill()
+		b.daemon.Wait()
+	}
+	return os.RemoveAll(b.dir)
+}
@@ -0,0 +1,257 @@
+package diskietest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie"
+)
+
+// Service runs a private dbus-daemon,
+// and serves a Backend on it as org.freedesktop.UDisks2,
+// so that diskie can be run against it without root and real devices.
+//
+// Set DBUS_SYSTEM_BUS_ADDRESS to Address to make diskie.Connect,
+// and the diskie command, use the service instead of the system bus.
+type Service struct {
+	Address string
+
+	backend     *Backend
+	bus         *Bus
+	conn        *dbus.Conn
+	unsubscribe func()
+}
+
+// StartService starts a dbus-daemon and serves the backend on it.
+// dbus-daemon must be in PATH.
+func StartService(backend *Backend) (*Service, error) {
+	bus, err := StartBus()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Service{
+		Address: bus.Address,
+		backend: backend,
+		bus:     bus,
+	}
+
+	err = s.start()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Service) start() error {
+	var err error
+
+	s.conn, err = dbus.Connect(s.Address)
+	if err != nil {
+		return fmt.Errorf("could not connect to dbus-daemon: %w", err)
+	}
+
+	err = s.export()
+	if err != nil {
+		return fmt.Errorf("could not export udisks objects: %w", err)
+	}
+
+	reply, err := s.conn.RequestName("org.freedesktop.UDisks2", dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return fmt.Errorf("could not request name: %w", err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return errors.New("could not request name: org.freedesktop.UDisks2 is already taken")
+	}
+
+	signals := make(chan *dbus.Signal, 128)
+
+	unsubscribe, err := s.backend.Subscribe(signals)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to backend signals: %w", err)
+	}
+
+	s.unsubscribe = func() {
+		unsubscribe()
+		close(signals)
+	}
+
+	go func() {
+		for sig := range signals {
+			s.conn.Emit(sig.Path, sig.Name, sig.Body...)
+		}
+	}()
+
+	return nil
+}
+
+// Close stops serving the backend and stops dbus-daemon.
+func (s *Service) Close() error {
+	var errs []error
+
+	if s.unsubscribe != nil {
+		s.unsubscribe()
+	}
+	if s.conn != nil {
+		errs = append(errs, s.conn.Close())
+	}
+
+	errs = append(errs, s.bus.Close())
+
+	return errors.Join(errs...)
+}
+
+func (s *Service) export() error {
+	root := dbus.ObjectPath("/org/freedesktop/UDisks2")
+
+	err := s.conn.ExportMethodTable(map[string]any{
+		"GetManagedObjects": func() (diskie.Objects, *dbus.Error) {
+			objects, err := s.backend.ManagedObjects(context.Background())
+			return objects, replyError(err)
+		},
+	}, root, "org.freedesktop.DBus.ObjectManager")
+	if err != nil {
+		return err
+	}
+
+	tables := map[string]map[string]any{
+
+		"org.freedesktop.DBus.Properties": {
+			"Get": func(msg dbus.Message, iface string, k string) (dbus.Variant, *dbus.Error) {
+				props, err := s.properties(msg, iface)
+				if err != nil {
+					return dbus.Variant{}, err
+				}
+				v, has := props[k]
+				if !has {
+					return dbus.Variant{}, dbus.NewError("org.freedesktop.DBus.Error.InvalidArgs", []any{"No such property " + k})
+				}
+				return v, nil
+			},
+			"GetAll": func(msg dbus.Message, iface string) (map[string]dbus.Variant, *dbus.Error) {
+				return s.properties(msg, iface)
+			},
+		},
+
+		"org.freedesktop.UDisks2.Manager": {
+			"GetBlockDevices": func(msg dbus.Message, options map[string]dbus.Variant) ([]dbus.ObjectPath, *dbus.Error) {
+				var paths []dbus.ObjectPath
+				err := s.call(msg, []any{options}, &paths)
+				return paths, err
+			},
+			"ResolveDevice": func(msg dbus.Message, devspec map[string]dbus.Variant, options map[string]dbus.Variant) ([]dbus.ObjectPath, *dbus.Error) {
+				var paths []dbus.ObjectPath
+				err := s.call(msg, []any{devspec, options}, &paths)
+				return paths, err
+			},
+			"LoopSetup": func(msg dbus.Message, fd dbus.UnixFD, options map[string]dbus.Variant) (dbus.ObjectPath, *dbus.Error) {
+				// the file descriptor was received along with the message
+				defer syscall.Close(int(fd))
+				var loop dbus.ObjectPath
+				err := s.call(msg, []any{fd, options}, &loop)
+				return loop, err
+			},
+		},
+
+		"org.freedesktop.UDisks2.Loop": {
+			"Delete": func(msg dbus.Message, options map[string]dbus.Variant) *dbus.Error {
+				return s.call(msg, []any{options})
+			},
+		},
+
+		"org.freedesktop.UDisks2.Block": {
+			"Format": func(msg dbus.Message, fsType string, options map[string]dbus.Variant) *dbus.Error {
+				return s.call(msg, []any{fsType, options})
+			},
+		},
+
+		"org.freedesktop.UDisks2.Drive": {
+			"Eject": func(msg dbus.Message, options map[string]dbus.Variant) *dbus.Error {
+				return s.call(msg, []any{options})
+			},
+			"PowerOff": func(msg dbus.Message, options map[string]dbus.Variant) *dbus.Error {
+				return s.call(msg, []any{options})
+			},
+		},
+
+		"org.freedesktop.UDisks2.Filesystem": {
+			"Mount": func(msg dbus.Message, options map[string]dbus.Variant) (string, *dbus.Error) {
+				var mountpoint string
+				err := s.call(msg, []any{options}, &mountpoint)
+				return mountpoint, err
+			},
+			"Unmount": func(msg dbus.Message, options map[string]dbus.Variant) *dbus.Error {
+				return s.call(msg, []any{options})
+			},
+		},
+
+		"org.freedesktop.UDisks2.Encrypted": {
+			"Unlock": func(msg dbus.Message, passphrase string, options map[string]dbus.Variant) (dbus.ObjectPath, *dbus.Error) {
+				var cleartext dbus.ObjectPath
+				err := s.call(msg, []any{passphrase, options}, &cleartext)
+				return cleartext, err
+			},
+			"Lock": func(msg dbus.Message, options map[string]dbus.Variant) *dbus.Error {
+				return s.call(msg, []any{options})
+			},
+		},
+	}
+
+	for iface, table := range tables {
+		err := s.conn.ExportSubtreeMethodTable(table, root, iface)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// call calls the backend method that msg calls.
+func (s *Service) call(msg dbus.Message, args []any, ret ...any) *dbus.Error {
+	path, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+	iface, _ := msg.Headers[dbus.FieldInterface].Value().(string)
+	member, _ := msg.Headers[dbus.FieldMember].Value().(string)
+
+	err := s.backend.Call(context.Background(), path, iface+"."+member, args, ret...)
+	return replyError(err)
+}
+
+func (s *Service) properties(msg dbus.Message, iface string) (map[string]dbus.Variant, *dbus.Error) {
+	path, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+
+	objects, err := s.backend.ManagedObjects(context.Background())
+	if err != nil {
+		return nil, replyError(err)
+	}
+
+	ifaces, has := objects[path]
+	if !has {
+		e := dbus.MakeNoObjectError(path)
+		return nil, &e
+	}
+
+	props, has := ifaces[iface]
+	if !has {
+		e := dbus.MakeUnknownInterfaceError(iface)
+		return nil, &e
+	}
+
+	return props, nil
+}
+
+func replyError(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+	var dbusErr dbus.Error
+	if errors.As(err, &dbusErr) {
+		return &dbusErr
+	}
+	return dbus.MakeFailedError(err)
+}
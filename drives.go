@@ -0,0 +1,148 @@
+package diskie
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// DriveBlocks is a drive along with its block devices.
+type DriveBlocks struct {
+	Drive *Drive
+
+	// the block devices of the whole drive (e.g., /dev/sda).
+	// there's usually one, but there's none for drives without media,
+	// and more than one for multipath drives.
+	Blocks []*BlockDevice
+
+	// the partitions of the drive, ordered by their number.
+	Partitions []*BlockDevice
+}
+
+func (c *Conn) Drives() ([]*DriveBlocks, error) {
+	return c.DrivesContext(context.Background())
+}
+
+// DrivesContext returns all of the drives, including those without block devices,
+// in the order udisks suggests for presenting them.
+func (c *Conn) DrivesContext(ctx context.Context) ([]*DriveBlocks, error) {
+	objects, err := c.backend.ManagedObjects(ctx)
+	if err != nil {
+		return nil, callError("org.freedesktop.DBus.ObjectManager.GetManagedObjects", err)
+	}
+
+	drives := newBlockMap(objects).Drives()
+
+	found := make(map[string]bool, len(drives))
+	for _, d := range drives {
+		found[d.Drive.ObjectPath] = true
+	}
+
+	for path, interfaces := range objects {
+		props, has := interfaces["org.freedesktop.UDisks2.Drive"]
+		if !has || found[string(path)] {
+			continue
+		}
+		// properties that can't be decoded are left out,
+		// like they are for the drives of block devices
+		drive, _ := decodeDrive(path, props)
+		drives = append(drives, &DriveBlocks{
+			Drive: drive,
+		})
+	}
+
+	sortDrives(drives)
+
+	return drives, nil
+}
+
+// Drives groups the block devices by their drive.
+// Only the drives that have block devices in the BlockMap are returned.
+func (bm *BlockMap) Drives() []*DriveBlocks {
+	drives := make(map[string]*DriveBlocks)
+
+	for _, b := range bm.BlockMap {
+		if b.Drive == nil {
+			continue
+		}
+
+		// drives in snapshots taken before drives had an ObjectPath
+		// are told apart by their Id
+		key := b.Drive.ObjectPath
+		if key == "" {
+			key = deref(b.Drive.Id)
+		}
+
+		d, has := drives[key]
+		if !has {
+			d = &DriveBlocks{
+				Drive: b.Drive,
+			}
+			drives[key] = d
+		}
+
+		if b.Partition == nil {
+			d.Blocks = append(d.Blocks, b)
+		}
+	}
+
+	sorted := make([]*DriveBlocks, 0, len(drives))
+
+	for _, d := range drives {
+		slices.SortFunc(d.Blocks, func(x, y *BlockDevice) int {
+			return cmp.Compare(x.ObjectPath, y.ObjectPath)
+		})
+		for _, b := range d.Blocks {
+			d.Partitions = append(d.Partitions, bm.PartitionsOf(b)...)
+		}
+		sorted = append(sorted, d)
+	}
+
+	sortDrives(sorted)
+
+	return sorted
+}
+
+// Eject ejects the media of the drive at objectPath (see Drive.Ejectable).
+func (c *Conn) Eject(objectPath string) error {
+	return c.EjectContext(context.Background(), objectPath)
+}
+
+func (c *Conn) EjectContext(ctx context.Context, objectPath string) error {
+	method := "org.freedesktop.UDisks2.Drive.Eject"
+
+	err := c.backend.Call(ctx, dbus.ObjectPath(objectPath), method, []any{map[string]dbus.Variant{}})
+	if err != nil {
+		return callError(method, err)
+	}
+
+	return nil
+}
+
+// PowerOff powers off the drive at objectPath (see Drive.CanPowerOff),
+// so that it can be safely removed.
+func (c *Conn) PowerOff(objectPath string) error {
+	return c.PowerOffContext(context.Background(), objectPath)
+}
+
+func (c *Conn) PowerOffContext(ctx context.Context, objectPath string) error {
+	method := "org.freedesktop.UDisks2.Drive.PowerOff"
+
+	err := c.backend.Call(ctx, dbus.ObjectPath(objectPath), method, []any{map[string]dbus.Variant{}})
+	if err != nil {
+		return callError(method, err)
+	}
+
+	return nil
+}
+
+func sortDrives(drives []*DriveBlocks) {
+	slices.SortFunc(drives, func(x, y *DriveBlocks) int {
+		return cmp.Or(
+			cmp.Compare(deref(x.Drive.SortKey), deref(y.Drive.SortKey)),
+			cmp.Compare(x.Drive.ObjectPath, y.Drive.ObjectPath),
+		)
+	})
+}
@@ -0,0 +1,104 @@
+package diskie
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type UnlockOptions struct {
+	ReadOnly          bool
+	KeyfileContents   []byte
+	NoUserInteraction bool
+
+	// TCRYPT and VeraCrypt options
+
+	Hidden   bool
+	System   bool
+	PIM      uint32
+	Keyfiles []string
+}
+
+func (c *Conn) Unlock(objectPath string, passphrase []byte, opts UnlockOptions) (*BlockDevice, error) {
+	return c.UnlockContext(context.Background(), objectPath, passphrase, opts)
+}
+
+func (c *Conn) UnlockContext(ctx context.Context, objectPath string, passphrase []byte, opts UnlockOptions) (*BlockDevice, error) {
+	method := "org.freedesktop.UDisks2.Encrypted.Unlock"
+
+	options := map[string]dbus.Variant{}
+	if opts.ReadOnly {
+		options["read-only"] = dbus.MakeVariant(true)
+	}
+	if len(opts.KeyfileContents) > 0 {
+		options["keyfile_contents"] = dbus.MakeVariant(opts.KeyfileContents)
+	}
+	if opts.NoUserInteraction {
+		options["auth.no_user_interaction"] = dbus.MakeVariant(true)
+	}
+	if opts.Hidden {
+		options["hidden"] = dbus.MakeVariant(true)
+	}
+	if opts.System {
+		options["system"] = dbus.MakeVariant(true)
+	}
+	if opts.PIM != 0 {
+		options["pim"] = dbus.MakeVariant(opts.PIM)
+	}
+	if len(opts.Keyfiles) > 0 {
+		options["keyfiles"] = dbus.MakeVariant(opts.Keyfiles)
+	}
+
+	var idType dbus.Variant
+
+	err := c.backend.Call(ctx, dbus.ObjectPath(objectPath), "org.freedesktop.DBus.Properties.Get", []any{"org.freedesktop.UDisks2.Block", "IdType"}, &idType)
+	if err != nil {
+		return nil, callError("org.freedesktop.DBus.Properties.Get", err)
+	}
+
+	// the passphrase argument is a string, which can't be zeroed after use.
+	// LUKS takes the same passphrase as keyfile contents, which stay bytes.
+	// other types (e.g., TCRYPT) hash keyfiles differently from passphrases,
+	// so the string copy can't be avoided for them.
+	args := []any{"", options}
+	if idType.Value() == "crypto_LUKS" && len(opts.KeyfileContents) == 0 {
+		options["keyfile_contents"] = dbus.MakeVariant(passphrase)
+	} else {
+		args[0] = string(passphrase)
+	}
+
+	var cleartext dbus.ObjectPath
+
+	err = c.backend.Call(ctx, dbus.ObjectPath(objectPath), method, args, &cleartext)
+	if err != nil {
+		return nil, callError(method, err)
+	}
+
+	blockmap, err := c.BlockDevicesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get block devices: %w", err)
+	}
+
+	block, has := blockmap.BlockMap[string(cleartext)]
+	if !has {
+		return nil, fmt.Errorf("cleartext device not found in the list of devices: %s", cleartext)
+	}
+
+	return block, nil
+}
+
+func (c *Conn) Lock(objectPath string) error {
+	return c.LockContext(context.Background(), objectPath)
+}
+
+func (c *Conn) LockContext(ctx context.Context, objectPath string) error {
+	method := "org.freedesktop.UDisks2.Encrypted.Lock"
+
+	err := c.backend.Call(ctx, dbus.ObjectPath(objectPath), method, []any{map[string]dbus.Variant{}})
+	if err != nil {
+		return callError(method, err)
+	}
+
+	return nil
+}
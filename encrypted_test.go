@@ -0,0 +1,56 @@
+package diskie_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie"
+	"github.com/koonix/diskie/diskietest"
+)
+
+// recordingBackend records the arguments of the calls made through it.
+type recordingBackend struct {
+	*diskietest.Backend
+	calls map[string][]any
+}
+
+func (r *recordingBackend) Call(ctx context.Context, objectPath dbus.ObjectPath, method string, args []any, ret ...any) error {
+	r.calls[method] = args
+	return r.Backend.Call(ctx, objectPath, method, args, ret...)
+}
+
+func TestUnlockPassesLUKSPassphraseAsBytes(t *testing.T) {
+	backend, err := diskietest.Load("diskietest/fixtures/luks-in-partition.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &recordingBackend{Backend: backend, calls: make(map[string][]any)}
+	dsk := diskie.NewConn(rec)
+
+	const sdb1 = "/org/freedesktop/UDisks2/block_devices/sdb1"
+
+	_, err = dsk.Unlock(sdb1, []byte("wrong"), diskie.UnlockOptions{})
+	if !errors.Is(err, diskie.ErrWrongPassphrase) {
+		t.Fatalf("Unlock() with a wrong passphrase: err = %v, want ErrWrongPassphrase", err)
+	}
+
+	cleartext, err := dsk.Unlock(sdb1, []byte("hunter2"), diskie.UnlockOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleartext.CryptoBackingDevice == nil || *cleartext.CryptoBackingDevice != sdb1 {
+		t.Errorf("cleartext device is not backed by %s: %+v", sdb1, cleartext)
+	}
+
+	args := rec.calls["org.freedesktop.UDisks2.Encrypted.Unlock"]
+	if args[0] != "" {
+		t.Errorf("passphrase argument = %q, want it empty", args[0])
+	}
+	options := args[1].(map[string]dbus.Variant)
+	keyfile, _ := options["keyfile_contents"].Value().([]byte)
+	if string(keyfile) != "hunter2" {
+		t.Errorf("keyfile_contents = %q, want %q", keyfile, "hunter2")
+	}
+}
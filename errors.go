@@ -0,0 +1,161 @@
+package diskie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// DecodeError reports a udisks property whose value couldn't be decoded.
+// The property is left unset.
+type DecodeError struct {
+	ObjectPath string
+	Interface  string
+	Property   string
+	Err        error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("could not decode property %s.%s of %s: %v", e.Interface, e.Property, e.ObjectPath, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// UnresolvedLinkError reports a property of a device
+// that refers to a device which doesn't exist,
+// for example because it was removed while the devices were being listed.
+type UnresolvedLinkError struct {
+	ObjectPath string
+	Property   string
+	Target     string
+}
+
+func (e *UnresolvedLinkError) Error() string {
+	return fmt.Sprintf("%s of %s refers to a device that was not found: %s", e.Property, e.ObjectPath, e.Target)
+}
+
+// BusyError is returned when a filesystem can't be unmounted
+// because processes are using it.
+type BusyError struct {
+	MountPoints []string
+
+	// the processes that use the filesystem, as far as they can be found.
+	Holders []Holder
+
+	Err error
+}
+
+func (e *BusyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BusyError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	ErrNotAuthorized   = errors.New("not authorized")
+	ErrDeviceBusy      = errors.New("device is busy")
+	ErrAlreadyMounted  = errors.New("already mounted")
+	ErrNotMounted      = errors.New("not mounted")
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	ErrDeviceNotFound  = errors.New("device not found")
+	ErrAmbiguousDevice = errors.New("device is ambiguous")
+	ErrCancelled       = errors.New("operation cancelled")
+	ErrTimedOut        = errors.New("operation timed out")
+)
+
+// Error is returned when a udisks method call fails.
+// Use errors.Is with the Err* variables to find out why it failed.
+type Error struct {
+	Method string
+
+	// the D-Bus error name (e.g., org.freedesktop.UDisks2.Error.NotMounted)
+	Name    string
+	Message string
+
+	kinds []error
+	err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("method %s failed: %v", e.Method, e.err)
+}
+
+func (e *Error) Unwrap() []error {
+	return append([]error{e.err}, e.kinds...)
+}
+
+// errorKinds maps D-Bus error names to the kinds of errors they represent.
+var errorKinds = map[string][]error{
+	"org.freedesktop.UDisks2.Error.NotAuthorized":          {ErrNotAuthorized},
+	"org.freedesktop.UDisks2.Error.NotAuthorizedCanObtain": {ErrNotAuthorized},
+	"org.freedesktop.UDisks2.Error.NotAuthorizedDismissed": {ErrNotAuthorized, ErrCancelled},
+	"org.freedesktop.UDisks2.Error.DeviceBusy":             {ErrDeviceBusy},
+	"org.freedesktop.UDisks2.Error.AlreadyMounted":         {ErrAlreadyMounted},
+	"org.freedesktop.UDisks2.Error.NotMounted":             {ErrNotMounted},
+	"org.freedesktop.UDisks2.Error.Cancelled":              {ErrCancelled},
+	"org.freedesktop.UDisks2.Error.AlreadyCancelled":       {ErrCancelled},
+	"org.freedesktop.UDisks2.Error.Timedout":               {ErrTimedOut},
+	"org.freedesktop.DBus.Error.AccessDenied":              {ErrNotAuthorized},
+	"org.freedesktop.DBus.Error.UnknownObject":             {ErrDeviceNotFound},
+	"org.freedesktop.DBus.Error.NoReply":                   {ErrTimedOut},
+	"org.freedesktop.DBus.Error.Timeout":                   {ErrTimedOut},
+	"org.freedesktop.DBus.Error.TimedOut":                  {ErrTimedOut},
+}
+
+// errorMessages maps parts of error messages to the kinds of errors they represent,
+// for errors that udisks reports as org.freedesktop.UDisks2.Error.Failed.
+var errorMessages = map[string]error{
+	"Incorrect passphrase":                  ErrWrongPassphrase,
+	"No key available with this passphrase": ErrWrongPassphrase,
+	"target is busy":                        ErrDeviceBusy,
+	"is not mounted":                        ErrNotMounted,
+	"is already mounted":                    ErrAlreadyMounted,
+}
+
+// contextError marks errors of done contexts as ErrTimedOut or ErrCancelled.
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimedOut, err)
+	} else if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("%w: %w", ErrCancelled, err)
+	}
+	return err
+}
+
+// callError wraps the error returned from calling a udisks method.
+func callError(method string, err error) error {
+	e := &Error{
+		Method: method,
+		err:    err,
+	}
+
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) {
+		e.err = contextError(err)
+		return e
+	}
+
+	e.Name = dbusErr.Name
+	if len(dbusErr.Body) > 0 {
+		e.Message, _ = dbusErr.Body[0].(string)
+	}
+
+	e.kinds = errorKinds[e.Name]
+
+	if len(e.kinds) == 0 {
+		for msg, kind := range errorMessages {
+			if strings.Contains(e.Message, msg) {
+				e.kinds = append(e.kinds, kind)
+			}
+		}
+	}
+
+	return e
+}
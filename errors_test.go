@@ -0,0 +1,79 @@
+package diskie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestCallError(t *testing.T) {
+	kinds := []error{
+		ErrNotAuthorized,
+		ErrDeviceBusy,
+		ErrAlreadyMounted,
+		ErrNotMounted,
+		ErrWrongPassphrase,
+		ErrDeviceNotFound,
+		ErrAmbiguousDevice,
+		ErrCancelled,
+		ErrTimedOut,
+	}
+
+	failed := func(msg string) error {
+		return dbus.Error{Name: "org.freedesktop.UDisks2.Error.Failed", Body: []any{msg}}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want []error
+	}{
+		{"not authorized", dbus.Error{Name: "org.freedesktop.UDisks2.Error.NotAuthorized"}, []error{ErrNotAuthorized}},
+		{"can obtain", dbus.Error{Name: "org.freedesktop.UDisks2.Error.NotAuthorizedCanObtain"}, []error{ErrNotAuthorized}},
+		{"dismissed", dbus.Error{Name: "org.freedesktop.UDisks2.Error.NotAuthorizedDismissed"}, []error{ErrNotAuthorized, ErrCancelled}},
+		{"busy", dbus.Error{Name: "org.freedesktop.UDisks2.Error.DeviceBusy"}, []error{ErrDeviceBusy}},
+		{"already mounted", dbus.Error{Name: "org.freedesktop.UDisks2.Error.AlreadyMounted"}, []error{ErrAlreadyMounted}},
+		{"not mounted", dbus.Error{Name: "org.freedesktop.UDisks2.Error.NotMounted"}, []error{ErrNotMounted}},
+		{"cancelled", dbus.Error{Name: "org.freedesktop.UDisks2.Error.Cancelled"}, []error{ErrCancelled}},
+		{"already cancelled", dbus.Error{Name: "org.freedesktop.UDisks2.Error.AlreadyCancelled"}, []error{ErrCancelled}},
+		{"udisks timeout", dbus.Error{Name: "org.freedesktop.UDisks2.Error.Timedout"}, []error{ErrTimedOut}},
+		{"access denied", dbus.Error{Name: "org.freedesktop.DBus.Error.AccessDenied"}, []error{ErrNotAuthorized}},
+		{"unknown object", dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownObject"}, []error{ErrDeviceNotFound}},
+		{"no reply", dbus.Error{Name: "org.freedesktop.DBus.Error.NoReply"}, []error{ErrTimedOut}},
+		{"dbus timeout", dbus.Error{Name: "org.freedesktop.DBus.Error.Timeout"}, []error{ErrTimedOut}},
+		{"dbus timed out", dbus.Error{Name: "org.freedesktop.DBus.Error.TimedOut"}, []error{ErrTimedOut}},
+		{"incorrect passphrase", failed("Error unlocking /dev/sdb2: Incorrect passphrase"), []error{ErrWrongPassphrase}},
+		{"no key", failed("Error unlocking /dev/sdb2: No key available with this passphrase"), []error{ErrWrongPassphrase}},
+		{"target busy", failed("Error unmounting /dev/sdb1: target is busy"), []error{ErrDeviceBusy}},
+		{"is not mounted", failed("Error unmounting /dev/sdb1: /dev/sdb1 is not mounted"), []error{ErrNotMounted}},
+		{"is already mounted", failed("Error mounting /dev/sdb1: /dev/sdb1 is already mounted"), []error{ErrAlreadyMounted}},
+		{"other failure", failed("Error mounting /dev/sdb1: wrong fs type"), nil},
+		{"deadline", fmt.Errorf("call: %w", context.DeadlineExceeded), []error{ErrTimedOut}},
+		{"context cancelled", fmt.Errorf("call: %w", context.Canceled), []error{ErrCancelled}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := callError("org.freedesktop.UDisks2.Filesystem.Mount", tt.err)
+
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("got %T, want *Error", err)
+			}
+			if dbusErr, ok := tt.err.(dbus.Error); ok && e.Name != dbusErr.Name {
+				t.Errorf("got Name %q, want %q", e.Name, dbusErr.Name)
+			}
+
+			for _, kind := range kinds {
+				want := slices.Contains(tt.want, kind)
+				if got := errors.Is(err, kind); got != want {
+					t.Errorf("errors.Is(err, %q) = %v, want %v", kind, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package diskie
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// OpenFolder shows the directory at path in the user's file manager
+// using org.freedesktop.FileManager1 on the session bus.
+// If no file manager provides that interface,
+// the opener command is executed with path appended to its arguments.
+// opener defaults to xdg-open if it's empty.
+func OpenFolder(path string, opener []string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("could not get the absolute path of %s: %w", path, err)
+	}
+
+	conn, err := dbus.SessionBus()
+	if err == nil {
+		err = ShowFolders(conn, []string{abs}, "")
+		if err == nil {
+			return nil
+		}
+		if !isServiceUnknown(err) {
+			return err
+		}
+	}
+
+	if len(opener) == 0 {
+		opener = []string{"xdg-open"}
+	}
+
+	cmd := exec.Command(opener[0], append(opener[1:], abs)...)
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("could not run %s: %w", opener[0], err)
+	}
+
+	return nil
+}
+
+// ShowFolders calls org.freedesktop.FileManager1.ShowFolders
+// with the given absolute paths on the given connection.
+func ShowFolders(conn *dbus.Conn, paths []string, startupId string) error {
+	obj := conn.Object(
+		"org.freedesktop.FileManager1",
+		"/org/freedesktop/FileManager1",
+	)
+
+	method := "org.freedesktop.FileManager1.ShowFolders"
+
+	uris := make([]string, 0, len(paths))
+	for _, p := range paths {
+		u := url.URL{Scheme: "file", Path: p}
+		uris = append(uris, u.String())
+	}
+
+	err := obj.Call(method, 0, uris, startupId).Err
+	if err != nil {
+		return fmt.Errorf("method %s failed: %w", method, err)
+	}
+
+	return nil
+}
+
+func isServiceUnknown(err error) bool {
+	var dbusErr dbus.Error
+	return errors.As(err, &dbusErr) &&
+		dbusErr.Name == "org.freedesktop.DBus.Error.ServiceUnknown"
+}
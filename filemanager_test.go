@@ -0,0 +1,140 @@
+package diskie_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie"
+)
+
+// fileManager is a stand-in for a file manager
+// that implements org.freedesktop.FileManager1.
+type fileManager struct {
+	calls chan []string
+	err   *dbus.Error
+}
+
+func (f *fileManager) ShowFolders(uris []string, startupId string) *dbus.Error {
+	f.calls <- uris
+	return f.err
+}
+
+func serveFileManager(t *testing.T, address string, err *dbus.Error) *fileManager {
+	f := &fileManager{
+		calls: make(chan []string, 1),
+		err:   err,
+	}
+	serve(t, address, "org.freedesktop.FileManager1", "/org/freedesktop/FileManager1", "org.freedesktop.FileManager1", f)
+	return f
+}
+
+func (f *fileManager) wait(t *testing.T) []string {
+	t.Helper()
+	select {
+	case uris := <-f.calls:
+		return uris
+	case <-time.After(5 * time.Second):
+		t.Fatal("ShowFolders was not called")
+		return nil
+	}
+}
+
+func TestShowFolders(t *testing.T) {
+	bus := startBus(t)
+	fm := serveFileManager(t, bus.Address, nil)
+
+	err := diskie.ShowFolders(connect(t, bus.Address), []string{
+		"/run/media/user/USB",
+		"/run/media/user/My Stick",
+		"/run/media/user/100%",
+		"/run/media/user/déjà vu",
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"file:///run/media/user/USB",
+		"file:///run/media/user/My%20Stick",
+		"file:///run/media/user/100%25",
+		"file:///run/media/user/d%C3%A9j%C3%A0%20vu",
+	}
+	got := fm.wait(t)
+	if !slices.Equal(got, want) {
+		t.Errorf("ShowFolders got %q, want %q", got, want)
+	}
+}
+
+func TestOpenFolder(t *testing.T) {
+	bus := startBus(t)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", bus.Address)
+
+	dir := t.TempDir()
+	mountpoint := filepath.Join(dir, "USB")
+	out := filepath.Join(dir, "opened")
+
+	// the opener records the path it's given
+	opener := []string{"sh", "-c", `printf %s "$1" > "$0"`, out}
+
+	opened := func() string {
+		data, err := os.ReadFile(out)
+		if os.IsNotExist(err) {
+			return ""
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(out)
+		return string(data)
+	}
+
+	// no file manager owns org.freedesktop.FileManager1 yet,
+	// so calling it fails with ServiceUnknown
+	t.Run("fallback", func(t *testing.T) {
+		err := diskie.OpenFolder(mountpoint, opener)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := opened(); got != mountpoint {
+			t.Errorf("opener got %q, want %q", got, mountpoint)
+		}
+	})
+
+	t.Run("file manager", func(t *testing.T) {
+		fm := serveFileManager(t, bus.Address, nil)
+
+		err := diskie.OpenFolder(mountpoint, opener)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"file://" + mountpoint}
+		if got := fm.wait(t); !slices.Equal(got, want) {
+			t.Errorf("ShowFolders got %q, want %q", got, want)
+		}
+		if got := opened(); got != "" {
+			t.Errorf("opener was run with %q although the file manager handled the call", got)
+		}
+	})
+}
+
+func TestOpenFolderFileManagerError(t *testing.T) {
+	bus := startBus(t)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", bus.Address)
+
+	serveFileManager(t, bus.Address, dbus.NewError("org.freedesktop.DBus.Error.Failed", []any{"no display"}))
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "opened")
+
+	err := diskie.OpenFolder(dir, []string{"touch", out})
+	if err == nil || !strings.Contains(err.Error(), "no display") {
+		t.Errorf("OpenFolder() err = %v, want the error of the file manager", err)
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Error("opener was run although the file manager exists")
+	}
+}
@@ -0,0 +1,106 @@
+package diskie
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type MountOptions struct {
+	FSType            string
+	Options           []string
+	NoUserInteraction bool
+}
+
+type UnmountOptions struct {
+	// lazily unmount the filesystem even if it's busy.
+	Force             bool
+	NoUserInteraction bool
+}
+
+func (c *Conn) Mount(objectPath string, opts MountOptions) (string, error) {
+	return c.MountContext(context.Background(), objectPath, opts)
+}
+
+func (c *Conn) MountContext(ctx context.Context, objectPath string, opts MountOptions) (string, error) {
+	method := "org.freedesktop.UDisks2.Filesystem.Mount"
+
+	options := map[string]dbus.Variant{}
+	if opts.FSType != "" {
+		options["fstype"] = dbus.MakeVariant(opts.FSType)
+	}
+	if len(opts.Options) > 0 {
+		options["options"] = dbus.MakeVariant(strings.Join(opts.Options, ","))
+	}
+	if opts.NoUserInteraction {
+		options["auth.no_user_interaction"] = dbus.MakeVariant(true)
+	}
+
+	var mountpoint string
+
+	err := c.backend.Call(ctx, dbus.ObjectPath(objectPath), method, []any{options}, &mountpoint)
+	if err != nil {
+		return "", callError(method, err)
+	}
+
+	return mountpoint, nil
+}
+
+func (c *Conn) Unmount(objectPath string, opts UnmountOptions) error {
+	return c.UnmountContext(context.Background(), objectPath, opts)
+}
+
+// UnmountContext unmounts the filesystem.
+// If it's busy, the returned error is a *BusyError
+// that lists the processes that are using it.
+func (c *Conn) UnmountContext(ctx context.Context, objectPath string, opts UnmountOptions) error {
+	method := "org.freedesktop.UDisks2.Filesystem.Unmount"
+
+	options := map[string]dbus.Variant{}
+	if opts.Force {
+		options["force"] = dbus.MakeVariant(true)
+	}
+	if opts.NoUserInteraction {
+		options["auth.no_user_interaction"] = dbus.MakeVariant(true)
+	}
+
+	err := c.backend.Call(ctx, dbus.ObjectPath(objectPath), method, []any{options})
+	if err != nil {
+		err = callError(method, err)
+		if errors.Is(err, ErrDeviceBusy) {
+			return c.busyError(ctx, objectPath, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// busyError attaches the processes that use the filesystem to err.
+// err is returned as is if they can't be found.
+func (c *Conn) busyError(ctx context.Context, objectPath string, err error) error {
+	blockmap, e := c.BlockDevicesContext(ctx)
+	if e != nil {
+		return err
+	}
+
+	b, has := blockmap.BlockMap[objectPath]
+	if !has || b.Filesystem == nil || b.Filesystem.MountPoints == nil || len(*b.Filesystem.MountPoints) == 0 {
+		return err
+	}
+
+	mountpoints := *b.Filesystem.MountPoints
+
+	holders, e := FindHolders(mountpoints...)
+	if e != nil {
+		return err
+	}
+
+	return &BusyError{
+		MountPoints: mountpoints,
+		Holders:     holders,
+		Err:         err,
+	}
+}
@@ -0,0 +1,84 @@
+package diskie
+
+import (
+	"context"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type FormatOptions struct {
+	Label string
+
+	// how to erase the existing data before formatting:
+	// "zero" writes zeros over the whole device,
+	// "ata-secure-erase" and "ata-secure-erase-enhanced" use the drive's own erase.
+	// by default the data is not erased.
+	Erase string
+
+	// put the filesystem inside a LUKS container
+	// that's locked with the given passphrase, if it's non-empty.
+	EncryptPassphrase []byte
+
+	// "luks1" or "luks2". udisks picks the default if empty.
+	EncryptType string
+
+	// return as soon as the device is ready to be formatted,
+	// instead of when formatting is done.
+	NoBlock bool
+
+	// unmount and lock the devices on top of the device,
+	// and remove their entries in /etc/fstab and /etc/crypttab.
+	TearDown bool
+
+	// make the caller the owner of the new filesystem.
+	TakeOwnership bool
+
+	NoUserInteraction bool
+}
+
+// Format creates a new filesystem of the given type on the device at objectPath,
+// destroying its contents.
+// fsType is a filesystem such as "ext4" or "vfat" (see the SupportedFilesystems
+// property of udisks' Manager), "swap", "dos" or "gpt" for a partition table,
+// or "empty" to only erase the signatures of existing contents.
+func (c *Conn) Format(objectPath string, fsType string, opts FormatOptions) error {
+	return c.FormatContext(context.Background(), objectPath, fsType, opts)
+}
+
+func (c *Conn) FormatContext(ctx context.Context, objectPath string, fsType string, opts FormatOptions) error {
+	method := "org.freedesktop.UDisks2.Block.Format"
+
+	options := map[string]dbus.Variant{}
+	if opts.Label != "" {
+		options["label"] = dbus.MakeVariant(opts.Label)
+	}
+	if opts.Erase != "" {
+		options["erase"] = dbus.MakeVariant(opts.Erase)
+	}
+	if len(opts.EncryptPassphrase) > 0 {
+		// udisks accepts the passphrase as bytes, which unlike a string can be zeroed
+		options["encrypt.passphrase"] = dbus.MakeVariant(opts.EncryptPassphrase)
+	}
+	if opts.EncryptType != "" {
+		options["encrypt.type"] = dbus.MakeVariant(opts.EncryptType)
+	}
+	if opts.NoBlock {
+		options["no-block"] = dbus.MakeVariant(true)
+	}
+	if opts.TearDown {
+		options["tear-down"] = dbus.MakeVariant(true)
+	}
+	if opts.TakeOwnership {
+		options["take-ownership"] = dbus.MakeVariant(true)
+	}
+	if opts.NoUserInteraction {
+		options["auth.no_user_interaction"] = dbus.MakeVariant(true)
+	}
+
+	err := c.backend.Call(ctx, dbus.ObjectPath(objectPath), method, []any{fsType, options})
+	if err != nil {
+		return callError(method, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package diskie
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Holder is a process that uses files under a mountpoint,
+// keeping the filesystem busy.
+type Holder struct {
+	PID     int
+	Command string
+
+	// the files under the mountpoint that the process uses:
+	// its working directory, root directory, executable,
+	// open files and memory-mapped files.
+	Paths []string
+}
+
+// FindHolders scans /proc for the processes that use files under the given mountpoints.
+// Processes that can't be inspected (e.g., those of other users, without root) are skipped,
+// and so is the calling process, so that it isn't offered to be killed.
+func FindHolders(mountpoints ...string) ([]Holder, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("could not list processes: %w", err)
+	}
+
+	under := func(path string) bool {
+		path = strings.TrimSuffix(path, " (deleted)")
+		for _, mp := range mountpoints {
+			if path == mp || strings.HasPrefix(path, strings.TrimSuffix(mp, "/")+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	self := os.Getpid()
+
+	var holders []Holder
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+
+		dir := filepath.Join("/proc", entry.Name())
+
+		var paths []string
+
+		add := func(path string) {
+			if under(path) && !slices.Contains(paths, path) {
+				paths = append(paths, path)
+			}
+		}
+
+		for _, link := range []string{"cwd", "root", "exe"} {
+			path, err := os.Readlink(filepath.Join(dir, link))
+			if err == nil {
+				add(path)
+			}
+		}
+
+		fds, _ := os.ReadDir(filepath.Join(dir, "fd"))
+		for _, fd := range fds {
+			path, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err == nil {
+				add(path)
+			}
+		}
+
+		for _, path := range mappedFiles(filepath.Join(dir, "maps")) {
+			add(path)
+		}
+
+		if len(paths) == 0 {
+			continue
+		}
+
+		comm, _ := os.ReadFile(filepath.Join(dir, "comm"))
+
+		slices.Sort(paths)
+
+		holders = append(holders, Holder{
+			PID:     pid,
+			Command: strings.TrimSuffix(string(comm), "\n"),
+			Paths:   paths,
+		})
+	}
+
+	return holders, nil
+}
+
+// mappedFiles returns the paths of the files in the given /proc/PID/maps file.
+func mappedFiles(maps string) []string {
+	f, err := os.Open(maps)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var paths []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// address perms offset dev inode pathname
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || !strings.HasPrefix(fields[5], "/") {
+			continue
+		}
+		path := strings.Join(fields[5:], " ")
+		if !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,69 @@
+package diskie_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/koonix/diskie"
+)
+
+func TestFindHolders(t *testing.T) {
+	dir := t.TempDir()
+
+	// this process holds a file under dir open, but isn't reported
+	f, err := os.Create(filepath.Join(dir, "open"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// a directory whose name starts with that of dir isn't under dir
+	other := dir + "-other"
+	err = os.Mkdir(other, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(other)
+
+	start := func(dir string) *exec.Cmd {
+		t.Helper()
+		cmd := exec.Command("sleep", "60")
+		cmd.Dir = dir
+		err := cmd.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		})
+		return cmd
+	}
+
+	child := start(dir)
+	start(other)
+
+	// Start returns after the child has changed its directory
+	holders, err := diskie.FindHolders(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(holders) != 1 {
+		t.Fatalf("got %d holders, want only the child: %+v", len(holders), holders)
+	}
+
+	h := holders[0]
+	if h.PID != child.Process.Pid {
+		t.Errorf("got PID %d, want %d of the child", h.PID, child.Process.Pid)
+	}
+	if h.Command != "sleep" {
+		t.Errorf("got command %q, want sleep", h.Command)
+	}
+	if !slices.Equal(h.Paths, []string{dir}) {
+		t.Errorf("got paths %v, want [%s]", h.Paths, dir)
+	}
+}
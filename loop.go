@@ -0,0 +1,88 @@
+package diskie
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type LoopOptions struct {
+	ReadOnly bool
+
+	// the part of the file that the loop device covers, in bytes.
+	// a zero Size covers the rest of the file after Offset.
+	Offset uint64
+	Size   uint64
+
+	// don't scan the loop device for partitions.
+	NoPartScan        bool
+	NoUserInteraction bool
+}
+
+// LoopSetup creates a loop device backed by the file at path,
+// and returns its object path.
+// The file is opened by diskie and its file descriptor is passed to udisks,
+// so path only has to be accessible to the caller.
+func (c *Conn) LoopSetup(path string, opts LoopOptions) (string, error) {
+	return c.LoopSetupContext(context.Background(), path, opts)
+}
+
+func (c *Conn) LoopSetupContext(ctx context.Context, path string, opts LoopOptions) (string, error) {
+	method := "org.freedesktop.UDisks2.Manager.LoopSetup"
+
+	flag := os.O_RDWR
+	if opts.ReadOnly {
+		flag = os.O_RDONLY
+	}
+
+	f, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return "", fmt.Errorf("could not open the file: %w", err)
+	}
+	defer f.Close()
+
+	options := map[string]dbus.Variant{}
+	if opts.ReadOnly {
+		options["read-only"] = dbus.MakeVariant(true)
+	}
+	if opts.Offset != 0 {
+		options["offset"] = dbus.MakeVariant(opts.Offset)
+	}
+	if opts.Size != 0 {
+		options["size"] = dbus.MakeVariant(opts.Size)
+	}
+	if opts.NoPartScan {
+		options["no-part-scan"] = dbus.MakeVariant(true)
+	}
+	if opts.NoUserInteraction {
+		options["auth.no_user_interaction"] = dbus.MakeVariant(true)
+	}
+
+	var objectPath dbus.ObjectPath
+
+	err = c.backend.Call(ctx, "/org/freedesktop/UDisks2/Manager", method, []any{dbus.UnixFD(f.Fd()), options}, &objectPath)
+	if err != nil {
+		return "", callError(method, err)
+	}
+
+	return string(objectPath), nil
+}
+
+// LoopDelete detaches the loop device at objectPath from its backing file.
+// The filesystems on the loop device should be unmounted first.
+func (c *Conn) LoopDelete(objectPath string) error {
+	return c.LoopDeleteContext(context.Background(), objectPath)
+}
+
+func (c *Conn) LoopDeleteContext(ctx context.Context, objectPath string) error {
+	method := "org.freedesktop.UDisks2.Loop.Delete"
+
+	err := c.backend.Call(ctx, dbus.ObjectPath(objectPath), method, []any{map[string]dbus.Variant{}})
+	if err != nil {
+		return callError(method, err)
+	}
+
+	return nil
+}
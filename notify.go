@@ -0,0 +1,166 @@
+package diskie
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Notifier sends desktop notifications through org.freedesktop.Notifications,
+// and runs the callbacks of their actions when they're invoked.
+type Notifier struct {
+	conn    *dbus.Conn
+	appName string
+
+	mu        sync.Mutex
+	callbacks map[uint32]map[string]func()
+}
+
+type Notification struct {
+	Summary string
+	Body    string
+	Icon    string
+	Actions []NotificationAction
+
+	// zero means the notification server's default
+	Timeout time.Duration
+}
+
+type NotificationAction struct {
+	Key      string
+	Label    string
+	Callback func()
+}
+
+// NewNotifier creates a notifier on the given connection,
+// which is normally the session bus.
+// Action callbacks are run until ctx is done.
+func NewNotifier(ctx context.Context, conn *dbus.Conn, appName string) (*Notifier, error) {
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath("/org/freedesktop/Notifications"),
+		dbus.WithMatchInterface("org.freedesktop.Notifications"),
+	}
+
+	err := conn.AddMatchSignal(match...)
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to notification signals: %w", err)
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	n := &Notifier{
+		conn:      conn,
+		appName:   appName,
+		callbacks: make(map[uint32]map[string]func()),
+	}
+
+	go func() {
+		defer conn.RemoveMatchSignal(match...)
+		defer conn.RemoveSignal(signals)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				n.dispatch(sig)
+			}
+		}
+	}()
+
+	return n, nil
+}
+
+func (n *Notifier) Notify(notification Notification) (uint32, error) {
+	obj := n.conn.Object(
+		"org.freedesktop.Notifications",
+		"/org/freedesktop/Notifications",
+	)
+
+	method := "org.freedesktop.Notifications.Notify"
+
+	actions := make([]string, 0, len(notification.Actions)*2)
+	for _, a := range notification.Actions {
+		actions = append(actions, a.Key, a.Label)
+	}
+
+	timeout := int32(-1)
+	if notification.Timeout > 0 {
+		timeout = int32(notification.Timeout.Milliseconds())
+	}
+
+	// hold the lock until the callbacks are registered,
+	// so that an action invoked right away isn't missed
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var id uint32
+
+	err := obj.Call(
+		method, 0,
+		n.appName,
+		uint32(0),
+		notification.Icon,
+		notification.Summary,
+		notification.Body,
+		actions,
+		map[string]dbus.Variant{},
+		timeout,
+	).Store(&id)
+	if err != nil {
+		return 0, fmt.Errorf("method %s failed: %w", method, err)
+	}
+
+	if len(notification.Actions) > 0 {
+		callbacks := make(map[string]func(), len(notification.Actions))
+		for _, a := range notification.Actions {
+			callbacks[a.Key] = a.Callback
+		}
+		n.callbacks[id] = callbacks
+	}
+
+	return id, nil
+}
+
+func (n *Notifier) dispatch(sig *dbus.Signal) {
+	switch sig.Name {
+
+	case "org.freedesktop.Notifications.ActionInvoked":
+		var id uint32
+		var key string
+		if dbus.Store(sig.Body, &id, &key) != nil {
+			return
+		}
+		n.mu.Lock()
+		callback := n.callbacks[id][key]
+		n.mu.Unlock()
+		if callback != nil {
+			callback()
+		}
+
+	case "org.freedesktop.Notifications.NotificationClosed":
+		var id uint32
+		var reason uint32
+		if dbus.Store(sig.Body, &id, &reason) != nil {
+			return
+		}
+		n.mu.Lock()
+		delete(n.callbacks, id)
+		n.mu.Unlock()
+	}
+}
+
+// Icon returns the name of the icon that udisks suggests for the device.
+func (b *BlockDevice) Icon() string {
+	if b.HintIconName != nil && *b.HintIconName != "" {
+		return *b.HintIconName
+	}
+	if b.HintSymbolicIconName != nil && *b.HintSymbolicIconName != "" {
+		return *b.HintSymbolicIconName
+	}
+	return "drive-removable-media"
+}
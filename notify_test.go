@@ -0,0 +1,147 @@
+package diskie_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie"
+)
+
+// notificationServer is a stand-in for a notification daemon
+// that implements org.freedesktop.Notifications.
+type notificationServer struct {
+	mu    sync.Mutex
+	calls []notifyCall
+}
+
+type notifyCall struct {
+	appName string
+	icon    string
+	summary string
+	body    string
+	actions []string
+	timeout int32
+}
+
+func (s *notificationServer) Notify(
+	appName string, replacesId uint32, icon string, summary string, body string,
+	actions []string, hints map[string]dbus.Variant, timeout int32) (uint32, *dbus.Error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, notifyCall{appName, icon, summary, body, actions, timeout})
+	return uint32(len(s.calls)), nil
+}
+
+func TestNotifier(t *testing.T) {
+	bus := startBus(t)
+
+	server := &notificationServer{}
+	serverConn := serve(t, bus.Address, "org.freedesktop.Notifications", "/org/freedesktop/Notifications", "org.freedesktop.Notifications", server)
+
+	emit := func(member string, body ...any) {
+		t.Helper()
+		err := serverConn.Emit("/org/freedesktop/Notifications", "org.freedesktop.Notifications."+member, body...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n, err := diskie.NewNotifier(ctx, connect(t, bus.Address), "diskie")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invoked := make(chan string, 4)
+	action := func(key string) diskie.NotificationAction {
+		return diskie.NotificationAction{
+			Key:      key,
+			Label:    "Label of " + key,
+			Callback: func() { invoked <- key },
+		}
+	}
+
+	mounted, err := n.Notify(diskie.Notification{
+		Summary: "Mounted sdb2",
+		Body:    "/run/media/user/SHARED",
+		Icon:    "drive-removable-media-usb",
+		Actions: []diskie.NotificationAction{action("open"), action("unmount")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := n.Notify(diskie.Notification{
+		Summary: "Device added: sdc",
+		Icon:    "drive-harddisk",
+		Actions: []diskie.NotificationAction{action("mount")},
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []notifyCall{
+		{
+			appName: "diskie",
+			icon:    "drive-removable-media-usb",
+			summary: "Mounted sdb2",
+			body:    "/run/media/user/SHARED",
+			actions: []string{"open", "Label of open", "unmount", "Label of unmount"},
+			timeout: -1,
+		},
+		{
+			appName: "diskie",
+			icon:    "drive-harddisk",
+			summary: "Device added: sdc",
+			actions: []string{"mount", "Label of mount"},
+			timeout: 5000,
+		},
+	}
+
+	server.mu.Lock()
+	got := server.calls
+	server.mu.Unlock()
+
+	if !slices.EqualFunc(got, want, func(a notifyCall, b notifyCall) bool {
+		return a.appName == b.appName && a.icon == b.icon &&
+			a.summary == b.summary && a.body == b.body &&
+			slices.Equal(a.actions, b.actions) && a.timeout == b.timeout
+	}) {
+		t.Fatalf("Notify was called with\n%+v\nwant\n%+v", got, want)
+	}
+
+	wait := func() string {
+		t.Helper()
+		select {
+		case key := <-invoked:
+			return key
+		case <-time.After(5 * time.Second):
+			t.Fatal("no callback was run")
+			return ""
+		}
+	}
+
+	emit("ActionInvoked", mounted, "unmount")
+	if key := wait(); key != "unmount" {
+		t.Fatalf("callback of %q was run, want unmount", key)
+	}
+
+	// the callbacks of a closed notification are dropped.
+	// signals are dispatched in order, so once the callback
+	// of the other notification has run, the dropped one would have too.
+	emit("NotificationClosed", mounted, uint32(2))
+	emit("ActionInvoked", mounted, "open")
+	emit("ActionInvoked", added, "mount")
+	if key := wait(); key != "mount" {
+		t.Fatalf("callback of %q was run after its notification was closed", key)
+	}
+}
@@ -0,0 +1,130 @@
+package diskie
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Resolve returns the device that spec refers to.
+// spec can be a udisks object path, a device path such as /dev/sdc2,
+// a symlink such as /dev/disk/by-label/USB, or one of
+// UUID=..., LABEL=... and PARTUUID=... like in fstab.
+//
+// If no device matches, the error wraps ErrDeviceNotFound.
+// If more than one device matches, the error wraps ErrAmbiguousDevice.
+func (bm *BlockMap) Resolve(spec string) (*BlockDevice, error) {
+	b, has := bm.BlockMap[spec]
+	if has {
+		return b, nil
+	}
+
+	key, value := parseDeviceSpec(spec)
+
+	var match func(b *BlockDevice) bool
+
+	switch key {
+	case "uuid":
+		match = func(b *BlockDevice) bool {
+			return b.IdUUID != nil && strings.EqualFold(*b.IdUUID, value)
+		}
+	case "label":
+		match = func(b *BlockDevice) bool {
+			return b.IdLabel != nil && *b.IdLabel == value
+		}
+	case "partuuid":
+		match = func(b *BlockDevice) bool {
+			p := b.Partition
+			return p != nil && p.UUID != nil && strings.EqualFold(*p.UUID, value)
+		}
+	default:
+		// symlinks that udisks doesn't know about resolve to the device node
+		resolved, err := filepath.EvalSymlinks(value)
+		if err != nil {
+			resolved = value
+		}
+		match = func(b *BlockDevice) bool {
+			for _, p := range []string{value, resolved} {
+				if b.Device != nil && *b.Device == p ||
+					b.PreferredDevice != nil && *b.PreferredDevice == p ||
+					b.Symlinks != nil && slices.Contains(*b.Symlinks, p) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	var matches []*BlockDevice
+
+	for _, b := range bm.BlockMap {
+		if match(b) {
+			matches = append(matches, b)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, spec)
+	case 1:
+		return matches[0], nil
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, b := range matches {
+		if b.Device != nil {
+			names = append(names, *b.Device)
+		} else {
+			names = append(names, b.ObjectPath)
+		}
+	}
+	slices.Sort(names)
+
+	return nil, fmt.Errorf("%w: %s matches %s", ErrAmbiguousDevice, spec, strings.Join(names, ", "))
+}
+
+// ResolveDevice asks udisks for the object paths of the devices that spec refers to.
+// spec is in the same format as in BlockMap.Resolve, except object paths.
+func (c *Conn) ResolveDevice(spec string) ([]string, error) {
+	return c.ResolveDeviceContext(context.Background(), spec)
+}
+
+func (c *Conn) ResolveDeviceContext(ctx context.Context, spec string) ([]string, error) {
+	method := "org.freedesktop.UDisks2.Manager.ResolveDevice"
+
+	key, value := parseDeviceSpec(spec)
+
+	devspec := map[string]dbus.Variant{
+		key: dbus.MakeVariant(value),
+	}
+
+	var paths []dbus.ObjectPath
+
+	err := c.backend.Call(ctx, "/org/freedesktop/UDisks2/Manager", method, []any{devspec, map[string]dbus.Variant{}}, &paths)
+	if err != nil {
+		return nil, callError(method, err)
+	}
+
+	resolved := make([]string, 0, len(paths))
+	for _, p := range paths {
+		resolved = append(resolved, string(p))
+	}
+
+	return resolved, nil
+}
+
+// parseDeviceSpec returns the key of the udisks devspec that spec is for
+// ("path", "uuid", "label" or "partuuid"), and its value.
+func parseDeviceSpec(spec string) (string, string) {
+	for _, key := range []string{"UUID", "LABEL", "PARTUUID"} {
+		value, found := strings.CutPrefix(spec, key+"=")
+		if found {
+			return strings.ToLower(key), value
+		}
+	}
+	return "path", spec
+}
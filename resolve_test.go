@@ -0,0 +1,85 @@
+package diskie_test
+
+import (
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/koonix/diskie"
+	"github.com/koonix/diskie/diskietest"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+
+		// device to unlock with the passphrase "hunter2" before listing the devices
+		unlock string
+
+		// device whose label is changed to that of sdb2, to make LABEL=SHARED ambiguous
+		relabel string
+
+		spec    string
+		want    string
+		wantErr error
+	}{
+		{name: "object path", fixture: "luks-in-partition", spec: "/org/freedesktop/UDisks2/block_devices/sdb2", want: "sdb2"},
+		{name: "device", fixture: "luks-in-partition", spec: "/dev/sdb1", want: "sdb1"},
+		{name: "symlink", fixture: "luks-in-partition", spec: "/dev/disk/by-label/SHARED", want: "sdb2"},
+		{name: "mapper symlink", fixture: "luks-in-partition", unlock: "sdb1", spec: "/dev/mapper/luks-0b3e2c39-8d7a-4c42-9a1e-2f4a8c6f1d20", want: "dm_2d0"},
+		{name: "symlink of locked device", fixture: "luks-in-partition", spec: "/dev/mapper/luks-0b3e2c39-8d7a-4c42-9a1e-2f4a8c6f1d20", wantErr: diskie.ErrDeviceNotFound},
+		{name: "uuid", fixture: "luks-in-partition", spec: "UUID=4A1B-2C3D", want: "sdb2"},
+		{name: "uuid in lower case", fixture: "luks-in-partition", spec: "UUID=4a1b-2c3d", want: "sdb2"},
+		{name: "partuuid", fixture: "luks-in-partition", spec: "PARTUUID=6f1c5b8e-02", want: "sdb2"},
+		{name: "partuuid in upper case", fixture: "luks-in-partition", spec: "PARTUUID=6F1C5B8E-01", want: "sdb1"},
+		{name: "partuuid as uuid", fixture: "luks-in-partition", spec: "UUID=6f1c5b8e-02", wantErr: diskie.ErrDeviceNotFound},
+		{name: "uuid as partuuid", fixture: "luks-in-partition", spec: "PARTUUID=4A1B-2C3D", wantErr: diskie.ErrDeviceNotFound},
+		{name: "label", fixture: "optical", spec: "LABEL=Debian 12.5.0 amd64 n", want: "sr0"},
+		{name: "label in wrong case", fixture: "luks-in-partition", spec: "LABEL=shared", wantErr: diskie.ErrDeviceNotFound},
+		{name: "lvm symlink", fixture: "luks-on-lvm", spec: "/dev/vg0/root", want: "dm_2d0"},
+		{name: "missing", fixture: "loop", spec: "/dev/loop9", wantErr: diskie.ErrDeviceNotFound},
+		{name: "ambiguous", fixture: "luks-in-partition", relabel: "sdb1", spec: "LABEL=SHARED", wantErr: diskie.ErrAmbiguousDevice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, err := diskietest.Load("diskietest/fixtures/" + tt.fixture + ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			dsk := diskie.NewConn(backend)
+
+			if tt.unlock != "" {
+				_, err := dsk.Unlock("/org/freedesktop/UDisks2/block_devices/"+tt.unlock, []byte("hunter2"), diskie.UnlockOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			bm, err := dsk.BlockDevices()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.relabel != "" {
+				label := "SHARED"
+				bm.BlockMap["/org/freedesktop/UDisks2/block_devices/"+tt.relabel].IdLabel = &label
+			}
+
+			b, err := bm.Resolve(tt.spec)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want an error wrapping %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := path.Base(b.ObjectPath); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
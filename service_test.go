@@ -0,0 +1,113 @@
+package diskie_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/koonix/diskie"
+	"github.com/koonix/diskie/diskietest"
+)
+
+// startService serves the fixture on a private bus
+// and points DBUS_SYSTEM_BUS_ADDRESS at it for the rest of the test,
+// or skips the test if dbus-daemon is not installed.
+func startService(t *testing.T, fixture string) *diskietest.Backend {
+	t.Helper()
+
+	needDBusDaemon(t)
+
+	backend, err := diskietest.Load("diskietest/fixtures/" + fixture + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := diskietest.StartService(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.Close() })
+
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", service.Address)
+
+	return backend
+}
+
+func TestServiceBlockDevices(t *testing.T) {
+	for _, fixture := range []string{"luks-in-partition", "luks-on-lvm", "optical", "loop"} {
+		t.Run(fixture, func(t *testing.T) {
+			backend := startService(t, fixture)
+
+			dsk, err := diskie.Connect()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := dsk.BlockDevices()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := diskie.NewConn(backend).BlockDevices()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got.Warnings) > 0 {
+				t.Errorf("unexpected warnings: %v", got.Warnings)
+			}
+			if g, w := names(got.Sort()), names(want.Sort()); !slices.Equal(g, w) {
+				t.Errorf("got %v over the bus, want %v", g, w)
+			}
+		})
+	}
+}
+
+func TestServiceAttachDetach(t *testing.T) {
+	startService(t, "luks-in-partition")
+
+	dsk, err := diskie.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const sdb1 = "/org/freedesktop/UDisks2/block_devices/sdb1"
+
+	cleartext, err := dsk.Unlock(sdb1, []byte("hunter2"), diskie.UnlockOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mountpoint, err := dsk.Mount(cleartext.ObjectPath, diskie.MountOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bm, err := dsk.BlockDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := bm.BlockMap[cleartext.ObjectPath]
+	if b == nil || b.Filesystem == nil || b.Filesystem.MountPoints == nil ||
+		!slices.Equal(*b.Filesystem.MountPoints, []string{mountpoint}) {
+		t.Fatalf("%s is not mounted at %s", cleartext.ObjectPath, mountpoint)
+	}
+	if bm.BlockMap[sdb1].CryptoClosingDevice != cleartext.ObjectPath {
+		t.Errorf("CryptoClosingDevice of sdb1 = %s, want %s", bm.BlockMap[sdb1].CryptoClosingDevice, cleartext.ObjectPath)
+	}
+
+	err = dsk.Unmount(cleartext.ObjectPath, diskie.UnmountOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dsk.Lock(sdb1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bm, err = dsk.BlockDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, has := bm.BlockMap[cleartext.ObjectPath]; has {
+		t.Errorf("%s is still present after locking sdb1", cleartext.ObjectPath)
+	}
+}
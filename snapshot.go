@@ -0,0 +1,62 @@
+package diskie
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// LoadSnapshot rebuilds a BlockMap from the given file,
+// which contains the JSON output of "diskie print".
+func LoadSnapshot(file string) (*BlockMap, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read snapshot: %w", err)
+	}
+	return ParseSnapshot(data)
+}
+
+// ParseSnapshot rebuilds a BlockMap from the JSON output of "diskie print",
+// in either the json-map or the json-array format.
+// A snapshot in the json-array format only contains the devices that were printed.
+func ParseSnapshot(data []byte) (*BlockMap, error) {
+	data = bytes.TrimSpace(data)
+
+	blockmap := make(map[string]*BlockDevice)
+
+	if len(data) > 0 && data[0] == '[' {
+		var blocks []*BlockDevice
+
+		err := json.Unmarshal(data, &blocks)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse snapshot: %w", err)
+		}
+
+		for i, b := range blocks {
+			if b == nil || b.ObjectPath == "" {
+				return nil, fmt.Errorf("could not parse snapshot: device %d has no ObjectPath", i)
+			}
+			blockmap[b.ObjectPath] = b
+		}
+	} else {
+		err := json.Unmarshal(data, &blockmap)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse snapshot: %w", err)
+		}
+
+		for path, b := range blockmap {
+			if b == nil {
+				delete(blockmap, path)
+				continue
+			}
+			if b.ObjectPath == "" {
+				b.ObjectPath = path
+			}
+		}
+	}
+
+	return &BlockMap{
+		BlockMap: blockmap,
+	}, nil
+}
@@ -0,0 +1,264 @@
+package diskie_test
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"testing"
+
+	"github.com/koonix/diskie"
+	"github.com/koonix/diskie/diskietest"
+)
+
+// device is what a test expects of a block device.
+// devices and drives are referred to by the base name of their object path.
+type device struct {
+	importance uint
+	root       string
+	rootDrive  string
+	closing    string
+}
+
+func TestTopologies(t *testing.T) {
+	const (
+		sandisk = "SanDisk_Ultra_4C530001230621116393"
+		samsung = "Samsung_SSD_980_1TB_S649NX0T123456A"
+		dvdrw   = "HL_DT_ST_DVDRAM_GH24NSD1_KZ4H9LB1234"
+	)
+
+	tests := []struct {
+		name    string
+		fixture string
+
+		// device to unlock with the passphrase "hunter2" before listing the devices
+		unlock string
+
+		sorted  []string
+		devices map[string]device
+
+		// the children of the devices that have any, in order.
+		// the parent of each child is the device it's listed under.
+		children map[string][]string
+
+		// the cleartext devices of unlocked encrypted devices
+		cleartext map[string]string
+
+		// drive: whole-drive devices, partitions
+		drives []string
+	}{
+		{
+			name:    "LUKS in partition, locked",
+			fixture: "luks-in-partition",
+			sorted:  []string{"sdb", "sdb1", "sdb2"},
+			devices: map[string]device{
+				"sdb":  {0, "sdb", sandisk, "sdb"},
+				"sdb1": {3, "sdb1", sandisk, "sdb1"},
+				"sdb2": {3, "sdb2", sandisk, "sdb2"},
+			},
+			children: map[string][]string{
+				"sdb": {"sdb1", "sdb2"},
+			},
+			drives: []string{sandisk + ": [sdb] [sdb1 sdb2]"},
+		},
+		{
+			name:    "LUKS in partition, unlocked",
+			fixture: "luks-in-partition",
+			unlock:  "sdb1",
+			sorted:  []string{"sdb", "dm_2d0", "sdb1", "sdb2"},
+			devices: map[string]device{
+				"sdb":    {0, "sdb", sandisk, "sdb"},
+				"sdb1":   {3, "sdb1", sandisk, "dm_2d0"},
+				"dm_2d0": {3, "sdb1", sandisk, "dm_2d0"},
+				"sdb2":   {3, "sdb2", sandisk, "sdb2"},
+			},
+			children: map[string][]string{
+				"sdb":  {"sdb1", "sdb2"},
+				"sdb1": {"dm_2d0"},
+			},
+			cleartext: map[string]string{
+				"sdb1": "dm_2d0",
+			},
+			drives: []string{sandisk + ": [sdb] [sdb1 sdb2]"},
+		},
+		{
+			// the logical volume has no drive and doesn't link to the physical volume,
+			// so the chain starts at the LUKS device
+			name:    "LUKS on LVM",
+			fixture: "luks-on-lvm",
+			sorted:  []string{"nvme0n1", "nvme0n1p2", "nvme0n1p1", "dm_2d1", "dm_2d0"},
+			devices: map[string]device{
+				"nvme0n1":   {0, "nvme0n1", samsung, "nvme0n1"},
+				"nvme0n1p1": {2, "nvme0n1p1", samsung, "nvme0n1p1"},
+				"nvme0n1p2": {0, "nvme0n1p2", samsung, "nvme0n1p2"},
+				"dm_2d0":    {2, "dm_2d0", "", "dm_2d1"},
+				"dm_2d1":    {2, "dm_2d0", "", "dm_2d1"},
+			},
+			children: map[string][]string{
+				"nvme0n1": {"nvme0n1p1", "nvme0n1p2"},
+				"dm_2d0":  {"dm_2d1"},
+			},
+			cleartext: map[string]string{
+				"dm_2d0": "dm_2d1",
+			},
+			drives: []string{samsung + ": [nvme0n1] [nvme0n1p1 nvme0n1p2]"},
+		},
+		{
+			name:    "optical",
+			fixture: "optical",
+			sorted:  []string{"sr0"},
+			devices: map[string]device{
+				"sr0": {3, "sr0", dvdrw, "sr0"},
+			},
+			drives: []string{dvdrw + ": [sr0] []"},
+		},
+		{
+			name:    "loop",
+			fixture: "loop",
+			sorted:  []string{"loop0", "loop1"},
+			devices: map[string]device{
+				"loop0": {3, "loop0", "", "loop0"},
+				"loop1": {0, "loop1", "", "loop1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, err := diskietest.Load("diskietest/fixtures/" + tt.fixture + ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			dsk := diskie.NewConn(backend)
+
+			if tt.unlock != "" {
+				_, err := dsk.Unlock("/org/freedesktop/UDisks2/block_devices/"+tt.unlock, []byte("hunter2"), diskie.UnlockOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			bm, err := dsk.BlockDevices()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bm.Warnings) > 0 {
+				t.Errorf("unexpected warnings: %v", bm.Warnings)
+			}
+
+			sorted := bm.Sort()
+			if got := names(sorted); !slices.Equal(got, tt.sorted) {
+				t.Errorf("Sort() = %v, want %v", got, tt.sorted)
+			}
+
+			for _, b := range sorted {
+				name := path.Base(b.ObjectPath)
+				want, has := tt.devices[name]
+				if !has {
+					t.Errorf("unexpected device %s", name)
+					continue
+				}
+
+				rootDrive := ""
+				if b.CryptoRootDrive != nil {
+					rootDrive = path.Base(b.CryptoRootDrive.ObjectPath)
+				}
+
+				got := device{
+					importance: b.Importance(),
+					root:       path.Base(b.CryptoRootDevice),
+					rootDrive:  rootDrive,
+					closing:    path.Base(b.CryptoClosingDevice),
+				}
+				if got != want {
+					t.Errorf("%s: got %+v, want %+v", name, got, want)
+				}
+			}
+
+			for _, b := range sorted {
+				name := path.Base(b.ObjectPath)
+
+				if got := names(bm.Children(b)); !slices.Equal(got, tt.children[name]) {
+					t.Errorf("Children(%s) = %v, want %v", name, got, tt.children[name])
+				}
+
+				wantParent := ""
+				for parent, children := range tt.children {
+					if slices.Contains(children, name) {
+						wantParent = parent
+					}
+				}
+				gotParent := ""
+				if p := bm.Parent(b); p != nil {
+					gotParent = path.Base(p.ObjectPath)
+				}
+				if gotParent != wantParent {
+					t.Errorf("Parent(%s) = %q, want %q", name, gotParent, wantParent)
+				}
+
+				gotCleartext := ""
+				if c := bm.CleartextOf(b); c != nil {
+					gotCleartext = path.Base(c.ObjectPath)
+				}
+				if gotCleartext != tt.cleartext[name] {
+					t.Errorf("CleartextOf(%s) = %q, want %q", name, gotCleartext, tt.cleartext[name])
+				}
+
+				wantPartitions := slices.DeleteFunc(slices.Clone(tt.children[name]), func(c string) bool {
+					return c == tt.cleartext[name]
+				})
+				if got := names(bm.PartitionsOf(b)); !slices.Equal(got, wantPartitions) {
+					t.Errorf("PartitionsOf(%s) = %v, want %v", name, got, wantPartitions)
+				}
+			}
+
+			drives, err := dsk.Drives()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := driveNames(drives); !slices.Equal(got, tt.drives) {
+				t.Errorf("Conn.Drives() = %v, want %v", got, tt.drives)
+			}
+			if got := driveNames(bm.Drives()); !slices.Equal(got, tt.drives) {
+				t.Errorf("BlockMap.Drives() = %v, want %v", got, tt.drives)
+			}
+
+			for minImportance := uint(0); minImportance <= 3; minImportance++ {
+				var want []string
+				for _, name := range tt.sorted {
+					if tt.devices[name].importance >= minImportance {
+						want = append(want, name)
+					}
+				}
+
+				filtered, err := bm.Filter(sorted, minImportance)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := names(filtered); !slices.Equal(got, want) {
+					t.Errorf("Filter(%d) = %v, want %v", minImportance, got, want)
+				}
+			}
+
+			_, err = bm.Filter(sorted, 4)
+			if err == nil {
+				t.Error("Filter(4) did not fail")
+			}
+		})
+	}
+}
+
+func names(blocks []*diskie.BlockDevice) []string {
+	var names []string
+	for _, b := range blocks {
+		names = append(names, path.Base(b.ObjectPath))
+	}
+	return names
+}
+
+func driveNames(drives []*diskie.DriveBlocks) []string {
+	var drivesNames []string
+	for _, d := range drives {
+		drivesNames = append(drivesNames, fmt.Sprintf("%s: %v %v", path.Base(d.Drive.ObjectPath), names(d.Blocks), names(d.Partitions)))
+	}
+	return drivesNames
+}
@@ -0,0 +1,87 @@
+package diskie
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+)
+
+// StoreUsage fills in the usage statistics of the mounted filesystems.
+func (bm *BlockMap) StoreUsage() error {
+	return bm.StoreUsageContext(context.Background())
+}
+
+// StoreUsageContext fills in the usage statistics of the mounted filesystems.
+// The filesystems are inspected in parallel, and those that haven't answered
+// by the time ctx is done (e.g., on a dying drive) are left without statistics.
+func (bm *BlockMap) StoreUsageContext(ctx context.Context) error {
+	type result struct {
+		fs *Filesystem
+		st syscall.Statfs_t
+		ok bool
+	}
+
+	// buffered so that the goroutines stuck in statfs can finish after we give up
+	results := make(chan result, len(bm.BlockMap))
+	pending := 0
+
+	for _, b := range bm.BlockMap {
+		fs := b.Filesystem
+		if fs == nil || fs.MountPoints == nil || len(*fs.MountPoints) == 0 {
+			continue
+		}
+		mountpoint := (*fs.MountPoints)[0]
+		pending++
+		go func() {
+			var st syscall.Statfs_t
+			err := syscall.Statfs(mountpoint, &st)
+			results <- result{fs, st, err == nil}
+		}()
+	}
+
+	for ; pending > 0; pending-- {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not get the usage of %d filesystems: %w", pending, ctx.Err())
+		case r := <-results:
+			if r.ok {
+				r.fs.storeUsage(&r.st)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (fs *Filesystem) storeUsage(st *syscall.Statfs_t) {
+	bsize := uint64(st.Frsize)
+	if bsize == 0 {
+		bsize = uint64(st.Bsize)
+	}
+
+	used := (st.Blocks - st.Bfree) * bsize
+	free := st.Bfree * bsize
+	available := st.Bavail * bsize
+	inodesTotal := st.Files
+	inodesFree := st.Ffree
+
+	fs.Used = &used
+	fs.Free = &free
+	fs.Available = &available
+	fs.InodesTotal = &inodesTotal
+	fs.InodesFree = &inodesFree
+}
+
+// UsagePercent returns the percentage of the space that's used,
+// out of the space that's available to unprivileged users, like df(1) does.
+// it returns 0 if the usage statistics are not known.
+func (fs *Filesystem) UsagePercent() float64 {
+	if fs == nil || fs.Used == nil || fs.Available == nil {
+		return 0
+	}
+	total := *fs.Used + *fs.Available
+	if total == 0 {
+		return 0
+	}
+	return float64(*fs.Used) * 100 / float64(total)
+}
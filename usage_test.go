@@ -0,0 +1,40 @@
+package diskie_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/koonix/diskie"
+)
+
+func TestStoreUsage(t *testing.T) {
+	mounted := []string{t.TempDir()}
+	missing := []string{filepath.Join(t.TempDir(), "missing")}
+
+	bm := &diskie.BlockMap{
+		BlockMap: map[string]*diskie.BlockDevice{
+			"mounted":   {Filesystem: &diskie.Filesystem{MountPoints: &mounted}},
+			"missing":   {Filesystem: &diskie.Filesystem{MountPoints: &missing}},
+			"unmounted": {Filesystem: &diskie.Filesystem{MountPoints: &[]string{}}},
+			"other":     {},
+		},
+	}
+
+	err := bm.StoreUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := bm.BlockMap["mounted"].Filesystem
+	if fs.Used == nil || fs.Free == nil || fs.Available == nil || fs.InodesTotal == nil || fs.InodesFree == nil {
+		t.Errorf("the usage of the mounted filesystem is missing: %+v", fs)
+	} else if *fs.Available > *fs.Free {
+		t.Errorf("Available (%d) is more than Free (%d)", *fs.Available, *fs.Free)
+	}
+
+	for _, name := range []string{"missing", "unmounted"} {
+		if fs := bm.BlockMap[name].Filesystem; fs.Used != nil {
+			t.Errorf("the %s filesystem has usage statistics: %+v", name, fs)
+		}
+	}
+}
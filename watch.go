@@ -0,0 +1,249 @@
+package diskie
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type EventType string
+
+const (
+	DeviceAdded   EventType = "DeviceAdded"
+	DeviceRemoved EventType = "DeviceRemoved"
+	Mounted       EventType = "Mounted"
+	Unmounted     EventType = "Unmounted"
+	Unlocked      EventType = "Unlocked"
+	Locked        EventType = "Locked"
+	MediaChanged  EventType = "MediaChanged"
+)
+
+type Event struct {
+	Type EventType
+
+	// the device as it is after the event.
+	// for DeviceRemoved, the device as it was before its removal.
+	Device *BlockDevice
+
+	// all of the block devices as they are after the event.
+	// their usage statistics are not filled in; see BlockMap.StoreUsage.
+	BlockMap *BlockMap
+}
+
+// Watch subscribes to the UDisks2 ObjectManager and PropertiesChanged signals
+// and sends an event on the returned channel for every change to a block device.
+// The channel is closed after ctx is done.
+func (c *Conn) Watch(ctx context.Context) (<-chan Event, error) {
+	signals := make(chan *dbus.Signal, 128)
+
+	unsubscribe, err := c.backend.Subscribe(signals)
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to udisks signals: %w", err)
+	}
+
+	// subscribe before taking the snapshot so that no change is missed
+	objects, err := c.backend.ManagedObjects(ctx)
+	if err != nil {
+		unsubscribe()
+		return nil, callError("org.freedesktop.DBus.ObjectManager.GetManagedObjects", err)
+	}
+
+	events := make(chan Event, 16)
+
+	queue := make(chan *dbus.Signal)
+
+	// signals are read as soon as they arrive, however slow the consumer is.
+	// otherwise the signals channel fills up, and godbus delivers the rest
+	// from separate goroutines, out of order, which corrupts the object tree.
+	go func() {
+		defer unsubscribe()
+
+		var pending []*dbus.Signal
+
+		for {
+			var out chan<- *dbus.Signal
+			var next *dbus.Signal
+			if len(pending) > 0 {
+				out = queue
+				next = pending[0]
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				pending = append(pending, sig)
+			case out <- next:
+				pending[0] = nil
+				pending = pending[1:]
+			}
+		}
+	}()
+
+	go func() {
+		defer close(events)
+
+		blockmap := newBlockMap(objects)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-queue:
+				if !applySignal(objects, sig) {
+					continue
+				}
+				updated := newBlockMap(objects)
+				for _, event := range diffBlockMaps(blockmap, updated) {
+					select {
+					case events <- event:
+					case <-ctx.Done():
+						return
+					}
+				}
+				blockmap = updated
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// applySignal applies the changes announced by the signal to the object tree,
+// and reports whether the signal was relevant.
+func applySignal(objects Objects, sig *dbus.Signal) bool {
+	switch sig.Name {
+
+	case "org.freedesktop.DBus.ObjectManager.InterfacesAdded":
+		var path dbus.ObjectPath
+		var added map[string]map[string]dbus.Variant
+		if dbus.Store(sig.Body, &path, &added) != nil {
+			return false
+		}
+		if objects[path] == nil {
+			objects[path] = make(map[string]map[string]dbus.Variant)
+		}
+		for iface, props := range added {
+			objects[path][iface] = props
+		}
+		return true
+
+	case "org.freedesktop.DBus.ObjectManager.InterfacesRemoved":
+		var path dbus.ObjectPath
+		var removed []string
+		if dbus.Store(sig.Body, &path, &removed) != nil {
+			return false
+		}
+		for _, iface := range removed {
+			delete(objects[path], iface)
+		}
+		if len(objects[path]) == 0 {
+			delete(objects, path)
+		}
+		return true
+
+	case "org.freedesktop.DBus.Properties.PropertiesChanged":
+		var iface string
+		var changed map[string]dbus.Variant
+		var invalidated []string
+		if dbus.Store(sig.Body, &iface, &changed, &invalidated) != nil {
+			return false
+		}
+		props, has := objects[sig.Path][iface]
+		if !has {
+			return false
+		}
+		for k, v := range changed {
+			props[k] = v
+		}
+		for _, k := range invalidated {
+			delete(props, k)
+		}
+		return true
+	}
+
+	return false
+}
+
+// diffBlockMaps returns the events that lead from old to new.
+func diffBlockMaps(old *BlockMap, new *BlockMap) []Event {
+	var events []Event
+
+	add := func(t EventType, b *BlockDevice) {
+		events = append(events, Event{
+			Type:     t,
+			Device:   b,
+			BlockMap: new,
+		})
+	}
+
+	for _, path := range sortedPaths(old) {
+		_, has := new.BlockMap[path]
+		if !has {
+			add(DeviceRemoved, old.BlockMap[path])
+		}
+	}
+
+	for _, path := range sortedPaths(new) {
+		n := new.BlockMap[path]
+		o, has := old.BlockMap[path]
+		if !has {
+			add(DeviceAdded, n)
+			continue
+		}
+
+		if isMediaAvailable(o) != isMediaAvailable(n) ||
+			deref(o.Size) != deref(n.Size) ||
+			deref(o.IdUUID) != deref(n.IdUUID) {
+			add(MediaChanged, n)
+		}
+
+		if !isUnlocked(o) && isUnlocked(n) {
+			add(Unlocked, n)
+		} else if isUnlocked(o) && !isUnlocked(n) {
+			add(Locked, n)
+		}
+
+		if !isMounted(o) && isMounted(n) {
+			add(Mounted, n)
+		} else if isMounted(o) && !isMounted(n) {
+			add(Unmounted, n)
+		}
+	}
+
+	return events
+}
+
+func sortedPaths(bm *BlockMap) []string {
+	paths := make([]string, 0, len(bm.BlockMap))
+	for path := range bm.BlockMap {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func isMounted(b *BlockDevice) bool {
+	fs := b.Filesystem
+	return fs != nil && fs.MountPoints != nil && len(*fs.MountPoints) > 0
+}
+
+func isUnlocked(b *BlockDevice) bool {
+	e := b.Encrypted
+	return e != nil && e.CleartextDevice != nil && *e.CleartextDevice != "/"
+}
+
+func isMediaAvailable(b *BlockDevice) bool {
+	d := b.Drive
+	return d == nil || d.MediaAvailable == nil || *d.MediaAvailable
+}
+
+func deref[T any](v *T) T {
+	if v == nil {
+		var zero T
+		return zero
+	}
+	return *v
+}
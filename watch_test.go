@@ -0,0 +1,143 @@
+package diskie_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/koonix/diskie"
+	"github.com/koonix/diskie/diskietest"
+)
+
+const sdb2 = "/org/freedesktop/UDisks2/block_devices/sdb2"
+
+func nextEvent(t *testing.T, events <-chan diskie.Event) diskie.Event {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("the events channel was closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return diskie.Event{}
+	}
+}
+
+// TestWatchSlowConsumer checks that no signal is lost or reordered
+// while the consumer of the events doesn't keep up,
+// e.g. while the daemon waits for a password.
+// like the bus, the backend queues the signals until Watch reads them.
+func TestWatchSlowConsumer(t *testing.T) {
+	backend, err := diskietest.Load("diskietest/fixtures/luks-in-partition.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsk := diskie.NewConn(backend)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := dsk.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// many more changes than the channels can buffer,
+	// while nobody reads the events
+	const cycles = 500
+	for range cycles {
+		_, err := dsk.Mount(sdb2, diskie.MountOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = dsk.Unmount(sdb2, diskie.UnmountOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := range 2 * cycles {
+		want := diskie.Mounted
+		if i%2 == 1 {
+			want = diskie.Unmounted
+		}
+		event := nextEvent(t, events)
+		if event.Type != want || event.Device.ObjectPath != sdb2 {
+			t.Fatalf("event %d: got %s of %s, want %s of %s", i, event.Type, event.Device.ObjectPath, want, sdb2)
+		}
+	}
+}
+
+// TestWatchIgnoresOtherSenders checks that clients other than udisksd
+// can't inject device events.
+func TestWatchIgnoresOtherSenders(t *testing.T) {
+	needDBusDaemon(t)
+
+	backend, err := diskietest.Load("diskietest/fixtures/luks-in-partition.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := diskietest.StartService(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", service.Address)
+
+	dsk, err := diskie.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := dsk.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evil := connect(t, service.Address)
+	err = evil.Emit("/org/freedesktop/UDisks2", "org.freedesktop.DBus.ObjectManager.InterfacesAdded",
+		dbus.ObjectPath("/org/freedesktop/UDisks2/block_devices/evil"),
+		map[string]map[string]dbus.Variant{
+			"org.freedesktop.UDisks2.Block": {
+				"Device": dbus.MakeVariant([]byte("/dev/evil\x00")),
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = evil.Emit(sdb2, "org.freedesktop.DBus.Properties.PropertiesChanged",
+		"org.freedesktop.UDisks2.Filesystem",
+		map[string]dbus.Variant{
+			"MountPoints": dbus.MakeVariant([][]byte{[]byte("/evil\x00")}),
+		},
+		[]string{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the signals of the service come after those of the other client
+	_, err = dsk.Mount(sdb2, diskie.MountOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := nextEvent(t, events)
+	if event.Type != diskie.Mounted || event.Device.ObjectPath != sdb2 {
+		t.Fatalf("got %s of %s, want Mounted of %s", event.Type, event.Device.ObjectPath, sdb2)
+	}
+	if mp := *event.Device.Filesystem.MountPoints; len(mp) != 1 || mp[0] != "/run/media/diskie/SHARED" {
+		t.Errorf("MountPoints = %q, want the mountpoint from the service", mp)
+	}
+	if _, has := event.BlockMap.BlockMap["/org/freedesktop/UDisks2/block_devices/evil"]; has {
+		t.Error("the device added by another client is in the BlockMap")
+	}
+}